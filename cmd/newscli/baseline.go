@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stateRetention bounds how long daily averages are kept in the state file.
+const stateRetention = 90 * 24 * time.Hour
+
+const dayLayout = "2006-01-02"
+
+// dailyScore accumulates the sentiment scores shown for one query on one day.
+type dailyScore struct {
+	Sum   float64 `json:"sum"`
+	Count int     `json:"count"`
+}
+
+// sentimentHistory keeps per-query daily sentiment averages across runs for
+// -baseline. Days are calendar days in loc.
+type sentimentHistory struct {
+	mu      sync.Mutex
+	days    int
+	loc     *time.Location
+	queries map[string]map[string]dailyScore
+}
+
+func newSentimentHistory(days int, loc *time.Location) *sentimentHistory {
+	return &sentimentHistory{days: days, loc: loc, queries: make(map[string]map[string]dailyScore)}
+}
+
+// historyKey normalizes a query so spacing and case do not split its history.
+func historyKey(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
+
+// record adds the scores of items to today's entry for query.
+func (h *sentimentHistory) record(query string, items []newsItem, now time.Time) {
+	if len(items) == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := historyKey(query)
+	days := h.queries[key]
+	if days == nil {
+		days = make(map[string]dailyScore)
+		h.queries[key] = days
+	}
+	day := now.In(h.loc).Format(dayLayout)
+	score := days[day]
+	for _, item := range items {
+		score.Sum += item.SentimentScore
+		score.Count++
+	}
+	days[day] = score
+}
+
+// baseline returns the mean of the daily averages for query over the h.days
+// days before today and how many of those days have data.
+func (h *sentimentHistory) baseline(query string, now time.Time) (float64, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	days := h.queries[historyKey(query)]
+	today := now.In(h.loc)
+	total, n := 0.0, 0
+	for i := 1; i <= h.days; i++ {
+		score, ok := days[today.AddDate(0, 0, -i).Format(dayLayout)]
+		if !ok || score.Count == 0 {
+			continue
+		}
+		total += score.Sum / float64(score.Count)
+		n++
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	return total / float64(n), n
+}
+
+// annotation describes the average of items against the baseline, e.g.
+// "avg 0.21 (↑0.08 vs 7-day)".
+func (h *sentimentHistory) annotation(query string, items []newsItem, now time.Time, opts displayOptions) string {
+	total := 0.0
+	for _, item := range items {
+		total += item.SentimentScore
+	}
+	avg := total / float64(len(items))
+	line := opts.sprintf("Sentiment avg %.2f", avg)
+	base, n := h.baseline(query, now)
+	if n == 0 {
+		return line + fmt.Sprintf(" (no history yet for a %d-day baseline)", h.days)
+	}
+	change := avg - base
+	arrow := "="
+	switch {
+	case change >= 0.005:
+		arrow = "↑"
+	case change <= -0.005:
+		arrow = "↓"
+		change = -change
+	}
+	line += opts.sprintf(" (%s%.2f vs %d-day", arrow, change, h.days)
+	if n < h.days {
+		line += fmt.Sprintf(", only %d of %d days have data", n, h.days)
+	}
+	return line + ")"
+}
+
+// load reads the state file at path; a missing file is an empty history.
+func (h *sentimentHistory) load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state struct {
+		Queries map[string]map[string]dailyScore `json:"queries"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for query, days := range state.Queries {
+		h.queries[query] = days
+	}
+	return nil
+}
+
+// save writes the history to path, dropping days older than stateRetention.
+func (h *sentimentHistory) save(path string, now time.Time) error {
+	cutoff := now.In(h.loc).Add(-stateRetention).Format(dayLayout)
+	h.mu.Lock()
+	for query, days := range h.queries {
+		for day := range days {
+			if day < cutoff {
+				delete(days, day)
+			}
+		}
+		if len(days) == 0 {
+			delete(h.queries, query)
+		}
+	}
+	data, err := json.MarshalIndent(map[string]any{"queries": h.queries}, "", "  ")
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// defaultStatePath returns news-agent/state.json in the user's config
+// directory, next to the -setup config, or "" when there is none.
+func defaultStatePath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "news-agent", "state.json")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+const (
+	defaultCardWidth = 80
+	minCardWidth     = 30
+)
+
+// terminalWidth reports whether f is a terminal and, if so, its width in
+// columns.
+func terminalWidth(f *os.File) (bool, int) {
+	fd := int(f.Fd())
+	if !term.IsTerminal(fd) {
+		return false, 0
+	}
+	width, _, err := term.GetSize(fd)
+	if err != nil || width <= 0 {
+		width = defaultCardWidth
+	}
+	return true, width
+}
+
+// printCards draws each item in a box sized to the terminal width, with the
+// title as a header and the details wrapped inside.
+func printCards(w io.Writer, items []newsItem, opts displayOptions) {
+	width := opts.width
+	if width < minCardWidth {
+		width = minCardWidth
+	}
+	inner := width - 4 // two borders plus one space of padding on each side
+	rule := strings.Repeat("─", inner+2)
+	hl := opts.activeHighlighter()
+	now := time.Now()
+	fmt.Fprintln(w)
+	for idx, item := range items {
+		opts.writeBreak(w, items, idx, now)
+		fmt.Fprintf(w, "╭%s╮\n", rule)
+		for _, line := range wrapText(fmt.Sprintf("[%d] %s", idx+1, item.Title), inner) {
+			cardLine(w, line, inner, hl, "")
+		}
+		fmt.Fprintf(w, "├%s┤\n", rule)
+		for _, detail := range itemDetails(item, opts) {
+			style := opts.lineStyle(item, detail)
+			for _, line := range wrapText(detail, inner) {
+				cardLine(w, line, inner, hl, style)
+			}
+		}
+		fmt.Fprintf(w, "╰%s╯\n", rule)
+	}
+}
+
+// cardLine writes one padded line of a card in style. Padding is measured
+// before highlighting so escape codes do not skew the border.
+func cardLine(w io.Writer, line string, inner int, hl *highlighter, style string) {
+	pad := inner - utf8.RuneCountInString(line)
+	if pad < 0 {
+		pad = 0
+	}
+	fmt.Fprintf(w, "│ %s%s │\n", styleLine(hl.apply(line), style), strings.Repeat(" ", pad))
+}
+
+// wrapText breaks text into lines of at most width runes on word boundaries,
+// splitting words that are longer than a whole line.
+func wrapText(text string, width int) []string {
+	var lines []string
+	var line []rune
+	for _, word := range strings.Fields(text) {
+		runes := []rune(word)
+		for len(runes) > width {
+			if len(line) > 0 {
+				lines = append(lines, string(line))
+				line = line[:0]
+			}
+			lines = append(lines, string(runes[:width]))
+			runes = runes[width:]
+		}
+		if len(line) > 0 && len(line)+1+len(runes) > width {
+			lines = append(lines, string(line))
+			line = line[:0]
+		}
+		if len(line) > 0 {
+			line = append(line, ' ')
+		}
+		line = append(line, runes...)
+	}
+	if len(line) > 0 || len(lines) == 0 {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
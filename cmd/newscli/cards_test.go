@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrintCardsIndexesTitles(t *testing.T) {
+	var buf bytes.Buffer
+	printCards(&buf, indexedItems, displayOptions{indexTitles: true, terminal: true, width: 60, location: time.UTC})
+	for _, want := range []string{"│ [1] Acme beats estimates ", "│ [2] Regulators probe Acme "} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("cards output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRenderCardsFallsBackWithoutColor(t *testing.T) {
+	opts := displayOptions{format: formatCards, terminal: true, width: 60, location: time.UTC}
+	for _, color := range []bool{false, true} {
+		opts.color = color
+		var buf bytes.Buffer
+		if err := render(&buf, indexedItems, opts); err != nil {
+			t.Fatal(err)
+		}
+		if boxed := strings.Contains(buf.String(), "│"); boxed != color {
+			t.Errorf("color %v: boxed output %v, want %v:\n%s", color, boxed, color, buf.String())
+		}
+	}
+}
+
+func TestRenderPlainCardsKeepLayoutWithoutEscapes(t *testing.T) {
+	items := []newsItem{{Title: "Acme beats estimates", Source: "Reuters", Sentiment: "positive", SentimentScore: 0.9}}
+	opts := displayOptions{format: formatCards, terminal: true, color: true, plain: true, width: 60,
+		highlight: newHighlighter([]string{"Acme"}), location: time.UTC}
+	var buf bytes.Buffer
+	if err := render(&buf, items, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "│") {
+		t.Errorf("plain cards fell back to the text listing:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "\x1b[") {
+		t.Errorf("plain cards contain escape codes: %q", buf.String())
+	}
+}
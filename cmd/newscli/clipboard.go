@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// clipboardTools are the commands tried, in order, to write to the system
+// clipboard: macOS, Wayland, X11 (two tools) and Windows or WSL.
+var clipboardTools = [][]string{
+	{"pbcopy"},
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+	{"clip.exe"},
+}
+
+// errNoClipboard is returned when none of clipboardTools is installed.
+var errNoClipboard = errors.New("no clipboard tool found (tried pbcopy, wl-copy, xclip, xsel, clip.exe)")
+
+// copyToClipboard writes data to the clipboard with the first available tool.
+func copyToClipboard(data []byte) error {
+	for _, tool := range clipboardTools {
+		path, err := exec.LookPath(tool[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, tool[1:]...)
+		cmd.Stdin = bytes.NewReader(data)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return errors.New(tool[0] + ": " + msg)
+			}
+			return errors.New(tool[0] + ": " + err.Error())
+		}
+		return nil
+	}
+	return errNoClipboard
+}
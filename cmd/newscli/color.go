@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// Values accepted by -color.
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+var colorModes = []string{colorAuto, colorAlways, colorNever}
+
+// useColor reports whether escape codes should be written for mode. auto
+// colors terminals unless NO_COLOR is set.
+func useColor(mode string, terminal bool) (bool, error) {
+	switch mode {
+	case colorAuto:
+		return terminal && os.Getenv("NO_COLOR") == "", nil
+	case colorAlways:
+		return true, nil
+	case colorNever:
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown mode %q (want one of %s)", mode, strings.Join(colorModes, ", "))
+}
+
+// sentimentStyle returns the ANSI style for a sentiment score: green for
+// positive and red for negative, bold and bright above 0.7 in magnitude,
+// plain from 0.3 and dim below that.
+func sentimentStyle(score float64) string {
+	hue, bright := "32", "92"
+	if score < 0 {
+		hue, bright = "31", "91"
+	}
+	switch magnitude := math.Abs(score); {
+	case magnitude > 0.7:
+		return "\x1b[1;" + bright + "m"
+	case magnitude >= 0.3:
+		return "\x1b[" + hue + "m"
+	case magnitude > 0:
+		return "\x1b[2;" + hue + "m"
+	}
+	return "\x1b[2m"
+}
+
+// styleLine wraps line in style, restoring it after any reset inside line
+// such as the one ending a highlighted term. An empty style returns line
+// unchanged.
+func styleLine(line, style string) string {
+	if style == "" {
+		return line
+	}
+	return style + strings.ReplaceAll(line, ansiReset, ansiReset+style) + ansiReset
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// compareBarHalf is the width of each half of a comparison bar; negative
+// averages fill left of the centre mark and positive ones fill right of it.
+const compareBarHalf = 10
+
+// sentimentSummary is the sentiment distribution of one query's results.
+type sentimentSummary struct {
+	query   string
+	err     error
+	count   int
+	byLabel map[string]int
+	average float64
+}
+
+func summarizeSentiment(query string, items []newsItem) sentimentSummary {
+	sum := sentimentSummary{query: query, count: len(items), byLabel: make(map[string]int)}
+	total := 0.0
+	for _, item := range items {
+		sum.byLabel[sentimentLabel(item)]++
+		total += item.SentimentScore
+	}
+	if len(items) > 0 {
+		sum.average = total / float64(len(items))
+	}
+	return sum
+}
+
+// parseVs splits the arguments of `vs <queryA> | <queryB>`.
+func parseVs(args string) (string, string, error) {
+	a, b, ok := strings.Cut(args, "|")
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if !ok || a == "" || b == "" {
+		return "", "", errors.New("usage: vs <queryA> | <queryB>")
+	}
+	return a, b, nil
+}
+
+// compare runs both queries concurrently and prints their sentiment side by
+// side. The -match-regex and -reject-regex filters apply, and the articles
+// that pass count as shown in -stats-file; a failed query is reported in its
+// column. Under -print-payload-only both payloads are printed instead. It
+// returns how many of the queries failed.
+func (s *session) compare(args string) (int, error) {
+	a, b, err := parseVs(args)
+	if err != nil {
+		return 0, err
+	}
+	queries := []string{a, b}
+	if s.payloadOnly {
+		for _, query := range queries {
+			fmt.Fprintf(s.out, "\n=== %s ===\n", query)
+			if err := s.printPayload(query); err != nil {
+				return 0, err
+			}
+		}
+		return 0, nil
+	}
+	sums := make([]sentimentSummary, len(queries))
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		wg.Add(1)
+		go func(i int, query string) {
+			defer wg.Done()
+			items, err := s.fetch(query)
+			if err != nil {
+				sums[i] = sentimentSummary{query: query, err: err}
+				return
+			}
+			items, _, _ = filterRegex(items, s.matchRE, s.rejectRE)
+			s.stats.recordShown(items)
+			sums[i] = summarizeSentiment(query, items)
+		}(i, query)
+	}
+	wg.Wait()
+	printComparison(s.out, sums, s.settings.display)
+	failed := 0
+	for _, sum := range sums {
+		if sum.err != nil {
+			failed++
+		}
+	}
+	if failed == len(sums) {
+		return failed, errors.New("both queries failed")
+	}
+	return failed, nil
+}
+
+// printComparison writes one column per summary: article counts per
+// sentiment label, the average score and a bar showing it.
+func printComparison(w io.Writer, sums []sentimentSummary, opts displayOptions) {
+	labelSet := make(map[string]bool)
+	for _, sum := range sums {
+		for label := range sum.byLabel {
+			labelSet[label] = true
+		}
+	}
+	labels := make([]string, 0, len(labelSet))
+	for label := range labelSet {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	row := func(name string, cell func(sentimentSummary) string) {
+		cells := []string{name}
+		for _, sum := range sums {
+			if sum.err != nil {
+				cells = append(cells, "-")
+			} else {
+				cells = append(cells, cell(sum))
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	fmt.Fprintln(w)
+	header := []string{""}
+	for _, sum := range sums {
+		header = append(header, sum.query)
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	row("Articles", func(sum sentimentSummary) string { return opts.sprintf("%d", sum.count) })
+	for _, label := range labels {
+		row(formatSentiment(label), func(sum sentimentSummary) string { return opts.sprintf("%d", sum.byLabel[label]) })
+	}
+	row("Average", func(sum sentimentSummary) string { return opts.sprintf("%+.2f", sum.average) })
+	row("", func(sum sentimentSummary) string { return sentimentBar(sum.average) })
+	tw.Flush()
+	for _, sum := range sums {
+		if sum.err != nil {
+			fmt.Fprintf(w, "Error: %s: %v\n", sum.query, sum.err)
+		}
+	}
+}
+
+// sentimentBar draws score, from -1 to 1, as a bar growing left or right of
+// a centre mark.
+func sentimentBar(score float64) string {
+	n := int(math.Round(math.Abs(score) * compareBarHalf))
+	if n > compareBarHalf {
+		n = compareBarHalf
+	}
+	left, right := strings.Repeat(" ", compareBarHalf), strings.Repeat(" ", compareBarHalf)
+	if score < 0 {
+		left = strings.Repeat(" ", compareBarHalf-n) + strings.Repeat("█", n)
+	} else {
+		right = strings.Repeat("█", n) + strings.Repeat(" ", compareBarHalf-n)
+	}
+	return "[" + left + "|" + right + "]"
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// config holds the defaults written by -setup. Command-line flags, and
+// NEWS_AGENT_BASE_URL for the base URL, take precedence over it.
+type config struct {
+	BaseURL string `json:"base_url,omitempty"`
+	Token   string `json:"token,omitempty"`
+	Limit   int    `json:"limit,omitempty"`
+	Format  string `json:"format,omitempty"`
+}
+
+// defaultConfigPath returns news-agent/config.json in the user's config
+// directory, or "" when there is none.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "news-agent", "config.json")
+}
+
+// loadConfig reads the config at path. A missing file is an empty config.
+func loadConfig(path string) (config, error) {
+	var cfg config
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// applyFlags sets the flags the config provides unless they were given on
+// the command line. Values are set on the flag directly rather than with
+// flag.Set, so flagSet keeps reporting only what the user typed and later
+// sources such as -credential-helper can still override them. The token is
+// not a flag; the caller sends it only to the saved base URL (see tokenFor).
+func (c config) applyFlags() error {
+	values := map[string]string{"format": c.Format}
+	if c.Limit > 0 {
+		values["limit"] = strconv.Itoa(c.Limit)
+	}
+	if strings.TrimSpace(os.Getenv("NEWS_AGENT_BASE_URL")) == "" {
+		values["base"] = c.BaseURL
+	}
+	for name, value := range values {
+		if value == "" || flagSet(name) {
+			continue
+		}
+		if err := flag.Lookup(name).Value.Set(value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (c config) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// The file may hold a token, so keep it private.
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// runSetup prompts for the connection details and defaults, checks that the
+// agent answers, and writes the config to path. current supplies the values
+// offered as defaults.
+func runSetup(path string, current config, timeout time.Duration) error {
+	if path == "" {
+		return errors.New("no config directory; pass -config")
+	}
+	in := bufio.NewReader(os.Stdin)
+	fmt.Printf("Writing %s. Press enter to keep the value in brackets.\n\n", path)
+
+	cfg := current
+	var err error
+	if cfg.BaseURL, err = prompt(in, "Agent base URL", cfg.BaseURL, validBaseURL); err != nil {
+		return err
+	}
+	if cfg.Token, err = promptSecret(in, "Token (leave empty for none)", cfg.Token); err != nil {
+		return err
+	}
+	limit, err := prompt(in, "Default limit", strconv.Itoa(cfg.Limit), func(v string) error {
+		if n, err := strconv.Atoi(v); err != nil || n < 1 {
+			return errors.New("must be a positive number")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	cfg.Limit, _ = strconv.Atoi(limit)
+	if cfg.Format, err = prompt(in, "Default format ("+strings.Join(outputFormats, ", ")+")", cfg.Format, func(v string) error {
+		if !validFormat(v) {
+			return fmt.Errorf("unknown format %q", v)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	client := newAgentClient(cfg.BaseURL, timeout)
+	client.token = cfg.Token
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	err = client.Warmup(ctx)
+	cancel()
+	if err != nil {
+		fmt.Printf("\nCould not reach the agent: %v\n", err)
+		answer, err := prompt(in, "Save anyway? (y/n)", "n", nil)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+			return errors.New("setup cancelled; nothing written")
+		}
+	} else {
+		fmt.Printf("\nReached %s.\n", backendLabel(client))
+	}
+	if err := cfg.save(path); err != nil {
+		return err
+	}
+	fmt.Printf("Saved %s.\n", path)
+	return nil
+}
+
+// prompt reads one line, returning fallback for an empty answer and asking
+// again while validate rejects the value.
+func prompt(in *bufio.Reader, label, fallback string, validate func(string) error) (string, error) {
+	for {
+		fmt.Printf("%s [%s]: ", label, fallback)
+		line, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", errors.New("setup cancelled; nothing written")
+		}
+		value := strings.TrimSpace(line)
+		if value == "" {
+			value = fallback
+		}
+		if validate == nil {
+			return value, nil
+		}
+		if err := validate(value); err != nil {
+			fmt.Printf("  %v\n", err)
+			continue
+		}
+		return value, nil
+	}
+}
+
+// promptSecret reads a value without echoing it when stdin is a terminal.
+// An existing value is kept on empty input; "-" clears it.
+func promptSecret(in *bufio.Reader, label, current string) (string, error) {
+	shown := ""
+	if current != "" {
+		shown = "keep current, - to clear"
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		value, err := prompt(in, label, shown, nil)
+		if err != nil {
+			return "", err
+		}
+		return secretValue(value, shown, current), nil
+	}
+	fmt.Printf("%s [%s]: ", label, shown)
+	data, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return secretValue(strings.TrimSpace(string(data)), "", current), nil
+}
+
+func secretValue(value, placeholder, current string) string {
+	switch value {
+	case "", placeholder:
+		return current
+	case "-":
+		return ""
+	}
+	return value
+}
+
+// tokenFor returns the saved token when base is the agent it was saved
+// with, so a -base or NEWS_AGENT_BASE_URL pointing elsewhere never receives
+// it. A config without base_url was written for the default agent.
+func (c config) tokenFor(base string) string {
+	saved := c.BaseURL
+	if saved == "" {
+		saved = defaultBaseURL
+	}
+	if c.Token == "" || !sameOrigin(saved, base) {
+		return ""
+	}
+	return c.Token
+}
+
+// sameOrigin reports whether two base URLs share a scheme and host.
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(strings.TrimSpace(a))
+	if err != nil || ua.Host == "" {
+		return false
+	}
+	ub, err := url.Parse(strings.TrimSpace(b))
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// validBaseURL accepts absolute http and https URLs.
+func validBaseURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an http:// or https:// URL")
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestConfigTokenFor(t *testing.T) {
+	cfg := config{BaseURL: "https://agent.example.com/", Token: "secret"}
+	tests := []struct {
+		base, want string
+	}{
+		{"https://agent.example.com", "secret"},
+		{"https://AGENT.example.com/v1", "secret"},
+		{"http://agent.example.com", ""},
+		{"https://other.example.com", ""},
+		{"https://agent.example.com:8443", ""},
+	}
+	for _, tt := range tests {
+		if got := cfg.tokenFor(tt.base); got != tt.want {
+			t.Errorf("tokenFor(%q) = %q, want %q", tt.base, got, tt.want)
+		}
+	}
+	if got := (config{Token: "secret"}).tokenFor(defaultBaseURL); got != "secret" {
+		t.Errorf("config without base_url: tokenFor(default) = %q, want the token", got)
+	}
+}
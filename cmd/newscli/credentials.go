@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// credentials are the connection details printed by a credential helper.
+type credentials struct {
+	BaseURL string `json:"base_url"`
+	Token   string `json:"token"`
+}
+
+// tokenFor returns the helper's token when base is the agent it was issued
+// for: the helper's base_url, or primary when the helper named none. Other
+// agents, such as the rest of a -merge-backends list, need their own
+// credentials and get no token.
+func (c credentials) tokenFor(base, primary string) string {
+	issued := c.BaseURL
+	if issued == "" {
+		issued = primary
+	}
+	if c.Token == "" || !sameOrigin(issued, base) {
+		return ""
+	}
+	return c.Token
+}
+
+// runCredentialHelper executes command (split on whitespace, without a
+// shell) and decodes the credentials it prints on stdout. It is run once at
+// startup and the result is kept for the rest of the session.
+func runCredentialHelper(ctx context.Context, command string) (credentials, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return credentials{}, errors.New("empty command")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return credentials{}, fmt.Errorf("%s: %w: %s", args[0], err, msg)
+		}
+		return credentials{}, fmt.Errorf("%s: %w", args[0], err)
+	}
+	var creds credentials
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return credentials{}, fmt.Errorf("%s: invalid output: %w", args[0], err)
+	}
+	if creds.BaseURL == "" && creds.Token == "" {
+		return credentials{}, fmt.Errorf("%s: output has neither base_url nor token", args[0])
+	}
+	return creds, nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestCredentialsTokenFor(t *testing.T) {
+	scoped := credentials{BaseURL: "https://agent.example.com", Token: "secret"}
+	unscoped := credentials{Token: "secret"}
+	tests := []struct {
+		name  string
+		creds credentials
+		base  string
+		want  string
+	}{
+		{"scoped, same host", scoped, "https://agent.example.com/", "secret"},
+		{"scoped, other host", scoped, "https://other.example.com", ""},
+		{"unscoped, primary", unscoped, "https://first.example.com", "secret"},
+		{"unscoped, other backend", unscoped, "https://second.example.com", ""},
+	}
+	for _, tt := range tests {
+		if got := tt.creds.tokenFor(tt.base, "https://first.example.com"); got != tt.want {
+			t.Errorf("%s: tokenFor(%q) = %q, want %q", tt.name, tt.base, got, tt.want)
+		}
+	}
+}
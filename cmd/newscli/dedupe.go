@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// absorb returns item followed by the duplicates it had already absorbed,
+// flattening them for the item that now absorbs it.
+func absorb(item newsItem) []newsItem {
+	nested := item.absorbed
+	item.absorbed = nil
+	return append([]newsItem{item}, nested...)
+}
+
+// printDedupeReport lists, for each shown item that absorbed duplicates, the
+// titles and sources of those duplicates. Numbers and source names match the
+// listing above.
+func printDedupeReport(w io.Writer, items []newsItem, opts displayOptions) {
+	fmt.Fprintln(w, "\nCollapsed duplicates:")
+	collapsed := 0
+	for idx, item := range items {
+		if len(item.absorbed) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "[%d] %s\n", idx+1, describeItem(item, opts))
+		for _, dup := range item.absorbed {
+			fmt.Fprintf(w, "    - %s\n", describeItem(dup, opts))
+		}
+		collapsed += len(item.absorbed)
+	}
+	if collapsed == 0 {
+		fmt.Fprintln(w, "None.")
+	}
+}
+
+// describeItem names an item by title, source as the listing shows it and,
+// under -merge-backends, backend.
+func describeItem(item newsItem, opts displayOptions) string {
+	source := item.Source
+	if !opts.rawFields {
+		source = opts.sourceName(item)
+	}
+	desc := fmt.Sprintf("%s (%s", item.Title, source)
+	if item.backend != "" {
+		desc += ", via " + item.backend
+	}
+	return desc + ")"
+}
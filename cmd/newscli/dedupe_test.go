@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDedupeReportUsesRenamedSources(t *testing.T) {
+	dup := newsItem{Title: "Acme beats estimates", Source: "ft.com"}
+	items := []newsItem{{Title: "Acme beats estimates", Source: "www.reuters.com", absorbed: []newsItem{dup}}}
+	opts := displayOptions{sourceNames: map[string]string{"www.reuters.com": "Reuters", "ft.com": "Financial Times"}}
+
+	var buf bytes.Buffer
+	printDedupeReport(&buf, items, opts)
+	for _, want := range []string{"[1] Acme beats estimates (Reuters)", "- Acme beats estimates (Financial Times)"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	opts.rawFields = true
+	printDedupeReport(&buf, items, opts)
+	if !strings.Contains(buf.String(), "(www.reuters.com)") {
+		t.Errorf("report under -raw-fields should keep the original source:\n%s", buf.String())
+	}
+}
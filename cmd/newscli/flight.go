@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// queryFlight coalesces identical concurrent queries into one shared call.
+// The shared call runs under its own context, which is cancelled once every
+// caller waiting for it has given up, and otherwise ends at the deadline of
+// the caller that started it.
+type queryFlight struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done    chan struct{}
+	items   []newsItem
+	err     error
+	waiters int
+	// shared is set once a second caller joins.
+	shared bool
+	cancel context.CancelFunc
+}
+
+// do returns the result of fn for key, starting fn unless a call for key is
+// already in flight. shared reports whether another caller took part. When
+// ctx is done first, do returns ctx.Err() itself.
+func (f *queryFlight) do(ctx context.Context, key string, fn func(context.Context) ([]newsItem, error)) (items []newsItem, shared bool, err error) {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]*flightCall)
+	}
+	call, ok := f.calls[key]
+	if ok {
+		call.shared = true
+	} else {
+		callCtx, cancel := detach(ctx)
+		call = &flightCall{done: make(chan struct{}), cancel: cancel}
+		f.calls[key] = call
+		go func() {
+			items, err := fn(callCtx)
+			f.mu.Lock()
+			call.items, call.err = items, err
+			f.forget(key, call)
+			f.mu.Unlock()
+			cancel()
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	f.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		f.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+			f.forget(key, call)
+		}
+		f.mu.Unlock()
+		return nil, ok, ctx.Err()
+	case <-call.done:
+		f.mu.Lock()
+		call.waiters--
+		shared = call.shared
+		f.mu.Unlock()
+		// Callers reorder and filter their results, so each gets its own copy.
+		return append([]newsItem(nil), call.items...), shared, call.err
+	}
+}
+
+// forget removes call so later queries start afresh. f.mu must be held.
+func (f *queryFlight) forget(key string, call *flightCall) {
+	if f.calls[key] == call {
+		delete(f.calls, key)
+	}
+}
+
+// detach returns a context that keeps ctx's deadline but not its
+// cancellation, so the caller that starts a shared call can leave without
+// cancelling it for the others.
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	base := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(base, deadline)
+	}
+	return context.WithCancel(base)
+}
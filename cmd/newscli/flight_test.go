@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQueryCoalescesIdenticalQueries(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Write([]byte(`[{"title":"Acme beats estimates"}]`))
+	}))
+	defer srv.Close()
+	c := newAgentClient(srv.URL, 5*time.Second)
+
+	var wg sync.WaitGroup
+	results := make([][]newsItem, 3)
+	for i, query := range []string{"acme", "ACME", "  acme "} {
+		wg.Add(1)
+		go func(i int, query string) {
+			defer wg.Done()
+			items, err := c.Query(context.Background(), query, 2)
+			if err != nil {
+				t.Errorf("Query(%q): %v", query, err)
+			}
+			results[i] = items
+		}(i, query)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("agent received %d requests, want 1", n)
+	}
+	for i, items := range results {
+		if len(items) != 1 || items[0].Title != "Acme beats estimates" {
+			t.Errorf("caller %d got %+v", i, items)
+		}
+	}
+	results[0][0].Title = "changed"
+	if results[1][0].Title == "changed" {
+		t.Error("callers share one result slice")
+	}
+}
+
+func TestQueryCancelsSharedCallWhenWaitersLeave(t *testing.T) {
+	cancelled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices the client going away once the body
+		// has been read.
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	defer srv.Close()
+	c := newAgentClient(srv.URL, time.Minute)
+	c.retries = 5
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Query(ctx, "acme", 2); err == nil {
+				t.Error("Query succeeded after cancellation")
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("shared request still running after every caller left")
+	}
+}
+
+func TestQuerySharedCallKeepsRunningForRemainingWaiter(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`[{"title":"Acme beats estimates"}]`))
+	}))
+	defer srv.Close()
+	c := newAgentClient(srv.URL, 5*time.Second)
+
+	first, leave := context.WithCancel(context.Background())
+	firstDone := make(chan error, 1)
+	go func() {
+		_, err := c.Query(first, "acme", 2)
+		firstDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	secondDone := make(chan error, 1)
+	go func() {
+		_, err := c.Query(context.Background(), "acme", 2)
+		secondDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	leave()
+	if err := <-firstDone; err == nil {
+		t.Error("abandoned Query succeeded")
+	}
+	close(release)
+	if err := <-secondDone; err != nil {
+		t.Errorf("remaining waiter: %v", err)
+	}
+}
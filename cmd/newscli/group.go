@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// groupDate is the -group-by value that buckets articles by publication day.
+const groupDate = "date"
+
+// unknownDate heads the trailing group of articles without a usable
+// published_at.
+const unknownDate = "Unknown date"
+
+// publishedDay returns the start of the day, in loc, on which item was
+// published.
+func publishedDay(item newsItem, loc *time.Location) (time.Time, bool) {
+	published, ok := parsePublished(item.PublishedAt, loc)
+	if !ok {
+		return time.Time{}, false
+	}
+	y, m, d := published.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc), true
+}
+
+// groupByDay orders items most recent day first, keeping their relative
+// order within a day and moving undated items to the end.
+func groupByDay(items []newsItem, loc *time.Location) []newsItem {
+	grouped := append([]newsItem(nil), items...)
+	sort.SliceStable(grouped, func(i, j int) bool {
+		a, aok := publishedDay(grouped[i], loc)
+		b, bok := publishedDay(grouped[j], loc)
+		if aok != bok {
+			return aok
+		}
+		return a.After(b)
+	})
+	return grouped
+}
+
+// dayLabel names the day group of item relative to now: Today, Yesterday
+// or the date.
+func dayLabel(item newsItem, loc *time.Location, now time.Time) string {
+	day, ok := publishedDay(item, loc)
+	if !ok {
+		return unknownDate
+	}
+	y, m, d := now.In(loc).Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	switch {
+	case day.Equal(today):
+		return "Today"
+	case day.Equal(today.AddDate(0, 0, -1)):
+		return "Yesterday"
+	}
+	return day.Format("Monday, 2 January 2006")
+}
+
+// groupHeader returns the heading to print before items[idx] when -group-by
+// date is active and it starts a new day, or "" otherwise. items must already
+// be ordered by groupByDay.
+func (o displayOptions) groupHeader(items []newsItem, idx int, now time.Time) string {
+	if o.groupBy != groupDate {
+		return ""
+	}
+	label := dayLabel(items[idx], o.location, now)
+	if idx > 0 && dayLabel(items[idx-1], o.location, now) == label {
+		return ""
+	}
+	return label
+}
+
+// writeBreak writes what precedes items[idx] in the human-readable formats:
+// a day heading when one starts, otherwise the separator between articles.
+func (o displayOptions) writeBreak(w io.Writer, items []newsItem, idx int, now time.Time) {
+	if header := o.groupHeader(items, idx, now); header != "" {
+		if idx > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "== %s ==\n\n", header)
+	} else if idx > 0 {
+		fmt.Fprintln(w, o.separator)
+	}
+}
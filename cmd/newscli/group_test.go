@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrintItemsGroupsByDay(t *testing.T) {
+	now := time.Now().UTC()
+	items := groupByDay([]newsItem{
+		{Title: "Undated", PublishedAt: "soon"},
+		{Title: "Older", PublishedAt: now.AddDate(0, 0, -1).Format(time.RFC1123Z)},
+		{Title: "First", PublishedAt: now.Format(time.RFC3339)},
+		{Title: "Second", PublishedAt: now.Format("2006-01-02 15:04:05")},
+	}, time.UTC)
+	var buf bytes.Buffer
+	printItems(&buf, items, displayOptions{groupBy: groupDate, separator: "---", location: time.UTC})
+
+	var got []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "==") || strings.HasPrefix(line, "[") || line == "---" {
+			got = append(got, line)
+		}
+	}
+	want := []string{"== Today ==", "[1] First", "---", "[2] Second", "== Yesterday ==", "[3] Older", "== Unknown date ==", "[4] Undated"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("grouped output:\n%s\nwant headings and titles:\n%s", buf.String(), strings.Join(want, "\n"))
+	}
+}
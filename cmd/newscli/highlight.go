@@ -0,0 +1,45 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	ansiHighlight = "\x1b[1;7m"
+	ansiReset     = "\x1b[0m"
+)
+
+// highlighter marks user-chosen terms in rendered lines.
+type highlighter struct {
+	terms []string
+	re    *regexp.Regexp
+}
+
+// newHighlighter matches any of terms case-insensitively, preferring the
+// longest term where several overlap. It returns nil when there are no terms.
+func newHighlighter(terms []string) *highlighter {
+	if len(terms) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), terms...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	quoted := make([]string, len(sorted))
+	for i, term := range sorted {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	return &highlighter{
+		terms: terms,
+		re:    regexp.MustCompile("(?i)" + strings.Join(quoted, "|")),
+	}
+}
+
+// apply wraps every match in line with ANSI reverse video. A nil highlighter
+// returns line unchanged.
+func (h *highlighter) apply(line string) string {
+	if h == nil {
+		return line
+	}
+	return h.re.ReplaceAllString(line, ansiHighlight+"$0"+ansiReset)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// localIndex is a bounded in-memory full-text index of the articles fetched
+// during a session, searched by the interactive `search-local` command.
+// When full, the least recently fetched article is evicted.
+type localIndex struct {
+	mu      sync.Mutex
+	max     int
+	entries []indexEntry // oldest first
+	byKey   map[string]int
+}
+
+type indexEntry struct {
+	item  newsItem
+	title map[string]int
+	body  map[string]int
+}
+
+func newLocalIndex(max int) *localIndex {
+	return &localIndex{max: max, byKey: make(map[string]int)}
+}
+
+// add indexes items, replacing earlier copies of the same article so that
+// refetched articles count as recent.
+func (x *localIndex) add(items []newsItem) {
+	if x == nil || x.max <= 0 {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, item := range items {
+		key := mergeKey(item)
+		if idx, ok := x.byKey[key]; ok {
+			x.remove(idx)
+		}
+		for len(x.entries) >= x.max {
+			x.remove(0)
+		}
+		x.byKey[key] = len(x.entries)
+		x.entries = append(x.entries, indexEntry{
+			item:  item,
+			title: termCounts(item.Title),
+			body:  termCounts(item.Summary + " " + item.Excerpt),
+		})
+	}
+}
+
+func (x *localIndex) remove(idx int) {
+	delete(x.byKey, mergeKey(x.entries[idx].item))
+	x.entries = append(x.entries[:idx], x.entries[idx+1:]...)
+	for i := idx; i < len(x.entries); i++ {
+		x.byKey[mergeKey(x.entries[i].item)] = i
+	}
+}
+
+func (x *localIndex) len() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return len(x.entries)
+}
+
+// search returns up to limit articles matching any of the terms, best first.
+// A term found in the title counts twice as much as one in the summary or
+// excerpt; ties favour the most recently fetched article.
+func (x *localIndex) search(terms string, limit int) []newsItem {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	query := tokenize(terms)
+	type hit struct {
+		idx   int
+		score int
+	}
+	var hits []hit
+	for i, entry := range x.entries {
+		score := 0
+		for _, term := range query {
+			score += 2*entry.title[term] + entry.body[term]
+		}
+		if score > 0 {
+			hits = append(hits, hit{idx: i, score: score})
+		}
+	}
+	sort.Slice(hits, func(a, b int) bool {
+		if hits[a].score != hits[b].score {
+			return hits[a].score > hits[b].score
+		}
+		return hits[a].idx > hits[b].idx
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	items := make([]newsItem, len(hits))
+	for i, h := range hits {
+		items[i] = x.entries[h.idx].item
+	}
+	return items
+}
+
+// load adds the articles stored in path, if it exists.
+func (x *localIndex) load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var items []newsItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	x.add(items)
+	return nil
+}
+
+// save writes the indexed articles to path, oldest first.
+func (x *localIndex) save(path string) error {
+	x.mu.Lock()
+	items := make([]newsItem, len(x.entries))
+	for i, entry := range x.entries {
+		items[i] = entry.item
+	}
+	x.mu.Unlock()
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// tokenize splits text into lower-cased runs of letters and digits.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func termCounts(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, token := range tokenize(text) {
+		counts[token]++
+	}
+	return counts
+}
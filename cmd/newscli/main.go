@@ -4,21 +4,40 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 	"unicode"
+
+	"github.com/itchyny/gojq"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
 )
 
 const (
-	defaultBaseURL = "http://localhost:8008"
-	defaultLimit   = 5
+	defaultBaseURL        = "http://localhost:8008"
+	defaultLimit          = 5
+	wordsPerMinute        = 200
+	defaultScoreBands     = "-1:strongly negative,-0.6:negative,-0.2:slightly negative,-0.05:neutral,0.05:slightly positive,0.2:positive,0.6:strongly positive"
+	defaultMergeThreshold = 0.8
+	// retryDelay is the pause before the first retry; later retries wait
+	// proportionally longer.
+	retryDelay = 250 * time.Millisecond
 )
 
 type newsItem struct {
@@ -30,6 +49,15 @@ type newsItem struct {
 	Sentiment      string  `json:"sentiment"`
 	SentimentScore float64 `json:"sentiment_score"`
 	Excerpt        string  `json:"excerpt"`
+
+	// coverage is the number of distinct sources reporting the story, set
+	// when -min-sources clusters the results.
+	coverage int
+	// backend names the agent that returned the item under -merge-backends.
+	backend string
+	// absorbed holds the duplicates collapsed into this item by
+	// -merge-backends or -min-sources, for -dedupe-report.
+	absorbed []newsItem
 }
 
 type apiError struct {
@@ -40,6 +68,63 @@ type apiError struct {
 type agentClient struct {
 	baseURL    string
 	httpClient *http.Client
+	// queryParam and limitParam name the payload keys sent to /news.
+	queryParam string
+	limitParam string
+	// verbose includes full endpoint URLs in errors instead of just the host.
+	verbose bool
+	// retries is how many times Query repeats a request whose response was
+	// truncated, waiting retryDelay longer before each attempt.
+	retries    int
+	retryDelay time.Duration
+	// trace logs a DNS, connect, TLS, TTFB and body-read breakdown of every
+	// query to stderr.
+	trace bool
+	// token, when set, is sent as a bearer token with every request.
+	token string
+	// maxResponseSize caps how many body bytes Query reads; 0 means no cap.
+	maxResponseSize int64
+	// maxLimitHeader names the response header in which the agent reports
+	// the largest limit it honours. When a query asks for more, Query fails
+	// if strictLimit is set and otherwise calls onLimitCapped.
+	maxLimitHeader string
+	strictLimit    bool
+	onLimitCapped  func(requested, capped int)
+
+	capsMu  sync.Mutex
+	caps    *capabilities
+	capsErr error
+
+	// flight coalesces identical concurrent queries.
+	flight queryFlight
+}
+
+// capabilities describes the agent version and the optional features it
+// supports, as reported by GET /capabilities.
+type capabilities struct {
+	Version  string   `json:"version"`
+	Features []string `json:"features"`
+}
+
+// baselineCapabilities is assumed when the agent cannot be probed: only the
+// core /news query is used.
+var baselineCapabilities = capabilities{Version: "unknown"}
+
+func (c capabilities) String() string {
+	features := "none"
+	if len(c.Features) > 0 {
+		features = strings.Join(c.Features, ", ")
+	}
+	return fmt.Sprintf("version %s (optional features: %s)", c.Version, features)
+}
+
+func (c capabilities) supports(feature string) bool {
+	for _, f := range c.Features {
+		if strings.EqualFold(f, feature) {
+			return true
+		}
+	}
+	return false
 }
 
 func newAgentClient(baseURL string, timeout time.Duration) *agentClient {
@@ -51,68 +136,849 @@ func newAgentClient(baseURL string, timeout time.Duration) *agentClient {
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
+		queryParam: "query",
+		limitParam: "limit",
+		retryDelay: retryDelay,
 	}
 }
 
-func (c *agentClient) Query(ctx context.Context, query string, limit int) ([]newsItem, error) {
+// payload builds the JSON body Query sends for query and limit.
+func (c *agentClient) payload(query string, limit int) map[string]any {
 	payload := map[string]any{
-		"query": query,
+		c.queryParam: query,
 	}
 	if limit > 0 {
-		payload["limit"] = limit
+		payload[c.limitParam] = limit
+	}
+	return payload
+}
+
+// Query asks the agent for up to limit articles about query. Responses cut
+// off mid-body are retried up to c.retries times.
+//
+// Identical queries (ignoring case and spacing) with the same limit that
+// overlap in time share one request. Each caller stops waiting when its own
+// ctx is done; the shared request is cancelled once all of them have, and
+// never outlives the deadline of the caller that started it.
+func (c *agentClient) Query(ctx context.Context, query string, limit int) ([]newsItem, error) {
+	key := fmt.Sprintf("%d:%s", limit, strings.ToLower(strings.Join(strings.Fields(query), " ")))
+	items, shared, err := c.flight.do(ctx, key, func(ctx context.Context) ([]newsItem, error) {
+		return c.query(ctx, query, limit)
+	})
+	if shared {
+		c.debugf("shared the in-flight request for %q", query)
+	}
+	if err != nil && err == ctx.Err() {
+		return nil, c.requestError(c.baseURL+"/news", err)
+	}
+	return items, err
+}
+
+func (c *agentClient) query(ctx context.Context, query string, limit int) ([]newsItem, error) {
+	for attempt := 0; ; attempt++ {
+		items, err := c.queryOnce(ctx, query, limit)
+		var truncated *truncatedError
+		if err == nil || !errors.As(err, &truncated) || attempt >= c.retries {
+			return items, err
+		}
+		c.debugf("retrying %q after a truncated response (retry %d of %d)", query, attempt+1, c.retries)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(time.Duration(attempt+1) * c.retryDelay):
+		}
 	}
-	body, err := json.Marshal(payload)
+}
+
+func (c *agentClient) queryOnce(ctx context.Context, query string, limit int) ([]newsItem, error) {
+	body, err := json.Marshal(c.payload(query, limit))
 	if err != nil {
 		return nil, err
 	}
 	endpoint := c.baseURL + "/news"
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	req, err := c.newRequest(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
 	if err != nil {
-		return nil, err
+		return nil, c.requestError(endpoint, err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	var timer *requestTimer
+	if c.trace {
+		timer = &requestTimer{}
+		req = timer.trace(req)
+	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return nil, err
+		if timer != nil {
+			timer.log(req.URL.Host, query, err)
+		}
+		return nil, c.requestError(endpoint, err)
 	}
 	defer resp.Body.Close()
 
-	data, err := io.ReadAll(resp.Body)
+	data, err := c.readBody(resp.Body)
+	if timer != nil {
+		timer.log(req.URL.Host, query, err)
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = &truncatedError{received: len(data), expected: resp.ContentLength, err: err}
+	}
 	if err != nil {
-		return nil, err
+		return nil, c.requestError(endpoint, err)
 	}
 
 	if resp.StatusCode >= 400 {
-		var apiErr apiError
-		if err := json.Unmarshal(data, &apiErr); err == nil && apiErr.Error != "" {
-			msg := apiErr.Error
-			if apiErr.Detail != "" {
-				msg += ": " + apiErr.Detail
-			}
-			return nil, errors.New(msg)
+		return nil, c.requestError(endpoint, statusError(resp, data))
+	}
+
+	if capped, ok := c.serverLimit(resp.Header); ok && limit > capped {
+		if c.strictLimit {
+			return nil, c.requestError(endpoint, fmt.Errorf("requested limit %d exceeds the server maximum of %d", limit, capped))
+		}
+		if c.onLimitCapped != nil {
+			c.onLimitCapped(limit, capped)
 		}
-		return nil, fmt.Errorf("agent returned status %s", resp.Status)
 	}
 
 	var items []newsItem
 	if err := json.Unmarshal(data, &items); err != nil {
-		return nil, err
+		if truncatedJSON(data) {
+			err = &truncatedError{received: len(data), expected: resp.ContentLength, err: err}
+		} else {
+			err = fmt.Errorf("%w (received %d bytes, body does not look truncated)", err, len(data))
+		}
+		return nil, c.requestError(endpoint, fmt.Errorf("decode response: %w", err))
 	}
 	return items, nil
 }
 
+// truncatedJSON reports whether data is a JSON document that stops before it
+// is complete, as opposed to one with a syntax error.
+func truncatedJSON(data []byte) bool {
+	var v any
+	err := json.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// statusError describes a failed response, preferring the agent's own error
+// message when the body carries one.
+func statusError(resp *http.Response, data []byte) error {
+	var apiErr apiError
+	if err := json.Unmarshal(data, &apiErr); err == nil && apiErr.Error != "" {
+		msg := apiErr.Error
+		if apiErr.Detail != "" {
+			msg += ": " + apiErr.Detail
+		}
+		return errors.New(msg)
+	}
+	return fmt.Errorf("agent returned status %s", resp.Status)
+}
+
+// truncatedError reports a response body that ended early, either because
+// the connection dropped or because the JSON stops mid-document. It is
+// treated as transient and retried under -retries.
+type truncatedError struct {
+	received int
+	// expected is the Content-Length, or -1 when the agent sent none.
+	expected int64
+	err      error
+}
+
+func (e *truncatedError) Error() string {
+	if e.expected >= 0 {
+		return fmt.Sprintf("%v (received %d of %d bytes, body looks truncated)", e.err, e.received, e.expected)
+	}
+	return fmt.Sprintf("%v (received %d bytes, body looks truncated)", e.err, e.received)
+}
+
+func (e *truncatedError) Unwrap() error { return e.err }
+
+// serverLimit reads the maximum limit advertised in the maxLimitHeader
+// response header, if any.
+func (c *agentClient) serverLimit(header http.Header) (int, bool) {
+	if c.maxLimitHeader == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(header.Get(c.maxLimitHeader)))
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// errNoCapabilities reports an agent without a /capabilities endpoint, such
+// as the bundled Flask app.
+var errNoCapabilities = errors.New("the agent has no /capabilities endpoint")
+
+// Capabilities probes GET /capabilities and caches the answer for the
+// lifetime of the client. The baseline is returned alongside the error when
+// the probe fails; it is cached only when the agent has no such endpoint, so
+// a probe that failed on a network error is tried again on the next call.
+func (c *agentClient) Capabilities(ctx context.Context) (capabilities, error) {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	if c.caps != nil {
+		return *c.caps, c.capsErr
+	}
+	caps, err := c.probeCapabilities(ctx)
+	if err != nil {
+		caps = baselineCapabilities
+		if !errors.Is(err, errNoCapabilities) {
+			return caps, err
+		}
+	}
+	c.caps, c.capsErr = &caps, err
+	return caps, err
+}
+
+func (c *agentClient) probeCapabilities(ctx context.Context) (capabilities, error) {
+	endpoint := c.baseURL + "/capabilities"
+	req, err := c.newRequest(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return capabilities{}, c.requestError(endpoint, err)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return capabilities{}, c.requestError(endpoint, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		return capabilities{}, c.requestError(endpoint, errNoCapabilities)
+	}
+	if resp.StatusCode >= 400 {
+		return capabilities{}, c.requestError(endpoint, fmt.Errorf("agent returned status %s", resp.Status))
+	}
+	var caps capabilities
+	if err := json.NewDecoder(resp.Body).Decode(&caps); err != nil {
+		return capabilities{}, c.requestError(endpoint, fmt.Errorf("decode response: %w", err))
+	}
+	if caps.Version == "" {
+		caps.Version = "unknown"
+	}
+	return caps, nil
+}
+
+// analyzePayload is the JSON body AnalyzeText sends.
+func analyzePayload(text string) map[string]string {
+	return map[string]string{"text": text}
+}
+
+// AnalyzeText asks the agent for the sentiment and summary of text via POST
+// /analyze-text. Agents that report their capabilities without "analyze" are
+// not asked; when the capabilities are unknown the endpoint is tried anyway.
+func (c *agentClient) AnalyzeText(ctx context.Context, text string) (newsItem, error) {
+	caps, err := c.Capabilities(ctx)
+	if err != nil {
+		c.debugf("capabilities unknown, trying /analyze-text anyway: %v", err)
+	} else if !caps.supports("analyze") {
+		return newsItem{}, fmt.Errorf("%s does not support text analysis (no \"analyze\" capability)", backendLabel(c))
+	}
+	body, err := json.Marshal(analyzePayload(text))
+	if err != nil {
+		return newsItem{}, err
+	}
+	endpoint := c.baseURL + "/analyze-text"
+	req, err := c.newRequest(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return newsItem{}, c.requestError(endpoint, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.do(req)
+	if err != nil {
+		return newsItem{}, c.requestError(endpoint, err)
+	}
+	defer resp.Body.Close()
+	data, err := c.readBody(resp.Body)
+	if err != nil {
+		return newsItem{}, c.requestError(endpoint, err)
+	}
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		return newsItem{}, c.requestError(endpoint, errors.New("the agent has no /analyze-text endpoint"))
+	}
+	if resp.StatusCode >= 400 {
+		return newsItem{}, c.requestError(endpoint, statusError(resp, data))
+	}
+	var item newsItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		return newsItem{}, c.requestError(endpoint, fmt.Errorf("decode response: %w", err))
+	}
+	return item, nil
+}
+
+// Warmup sends a HEAD request to /health so DNS resolution, the TCP
+// connection and any TLS handshake are done before the first real query. The
+// connection is returned to the client's idle pool for reuse.
+func (c *agentClient) Warmup(ctx context.Context) error {
+	endpoint := c.baseURL + "/health"
+	req, err := c.newRequest(ctx, http.MethodHead, endpoint, nil)
+	if err != nil {
+		return c.requestError(endpoint, err)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return c.requestError(endpoint, err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
+
+// readBody reads a response body, enforcing maxResponseSize on the bytes
+// actually received. Content-Length is not consulted, so chunked responses
+// are bounded the same way as sized ones.
+func (c *agentClient) readBody(body io.Reader) ([]byte, error) {
+	if c.maxResponseSize <= 0 {
+		return io.ReadAll(body)
+	}
+	data, err := io.ReadAll(io.LimitReader(body, c.maxResponseSize+1))
+	if err != nil {
+		return data, err
+	}
+	if int64(len(data)) > c.maxResponseSize {
+		return nil, fmt.Errorf("response exceeds %d bytes", c.maxResponseSize)
+	}
+	return data, nil
+}
+
+// do sends req, logging the protocol negotiated on each new connection
+// under -v.
+func (c *agentClient) do(req *http.Request) (*http.Response, error) {
+	if !c.verbose {
+		return c.httpClient.Do(req)
+	}
+	reused := true
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := c.httpClient.Do(req)
+	if err == nil && !reused {
+		c.debugf("new connection to %s negotiated %s", req.URL.Host, resp.Proto)
+	}
+	return resp, err
+}
+
+// debugf writes a diagnostic line to stderr under -v.
+func (c *agentClient) debugf(format string, args ...any) {
+	if c.verbose {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+}
+
+// newTransport returns a transport that negotiates HTTP/2 over TLS when
+// http2 is set and is limited to HTTP/1.1 otherwise. Up to maxIdle idle
+// connections are kept per host so concurrent HTTP/1.1 queries can reuse
+// them; with HTTP/2 they share one multiplexed connection instead.
+func newTransport(http2 bool, maxIdle int) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ForceAttemptHTTP2 = http2
+	if !http2 {
+		// A non-nil, empty map disables the transport's HTTP/2 upgrade.
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if maxIdle > t.MaxIdleConnsPerHost {
+		t.MaxIdleConnsPerHost = maxIdle
+	}
+	return t
+}
+
+// newRequest builds a request to endpoint carrying the client's credentials.
+func (c *agentClient) newRequest(ctx context.Context, method, endpoint string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// requestError prefixes err with the request target. Only the host is shown
+// unless the client is verbose, so paths, query strings and credentials in the
+// endpoint stay out of logs. *url.Error is unwrapped because its message
+// embeds the full URL.
+func (c *agentClient) requestError(endpoint string, err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	target := endpoint
+	if !c.verbose {
+		target = "agent"
+		if parsed, perr := url.Parse(endpoint); perr == nil && parsed.Host != "" {
+			target = parsed.Host
+		}
+	}
+	return fmt.Errorf("%s: %w", target, err)
+}
+
 func main() {
-	baseURL := flag.String("base", envOrDefault("NEWS_AGENT_BASE_URL", defaultBaseURL), "news agent base URL")
+	baseURL := flag.String("base", envOrDefault("NEWS_AGENT_BASE_URL", defaultBaseURL), "news agent base URL (comma-separated with -merge-backends)")
+	mergeBackends := flag.Bool("merge-backends", false, "query every -base URL and merge their results")
 	limit := flag.Int("limit", defaultLimit, "maximum articles to request per query")
 	timeout := flag.Duration("timeout", 10*time.Second, "HTTP client timeout")
+	jqExpr := flag.String("jq", "", "jq expression applied to the results before printing")
+	tagsFile := flag.String("tags-file", "", "JSON file mapping sources or URL hosts to tags shown next to results")
+	queryParam := flag.String("query-param", "query", "JSON key used for the query in the request payload")
+	limitParam := flag.String("limit-param", "limit", "JSON key used for the limit in the request payload")
+	minSources := flag.Int("min-sources", 0, "only show stories covered by at least this many distinct sources")
+	collapse := flag.Bool("collapse-whitespace", false, "collapse newlines and runs of whitespace in summaries and excerpts")
+	verbose := flag.Bool("v", false, "verbose output, including full request URLs in errors")
+	warmup := flag.Bool("warmup", false, "open the connection to the agent at startup to speed up the first query")
+	explainScore := flag.Bool("explain-score", false, "describe the sentiment score in words next to the number")
+	scoreBands := flag.String("score-bands", defaultScoreBands, "comma-separated threshold:label pairs used by -explain-score")
+	matchRegex := flag.String("match-regex", "", "only show articles whose title or summary matches this regular expression")
+	rejectRegex := flag.String("reject-regex", "", "hide articles whose title or summary matches this regular expression")
+	emptyMessage := flag.String("empty-message", "No articles found.", "message printed in text format when a query returns nothing")
+	emptyExitCode := flag.Int("empty-exit-code", 0, "exit code for one-shot runs that return no articles")
+	indexTitles := flag.Bool("prepend-index-to-title", false, "include the 1-based result index in every output format")
+	readingTime := flag.Bool("reading-time", false, "show an estimated reading time for each article")
+	var rawFields bool
+	flag.BoolVar(&rawFields, "raw-fields", false, "print fields exactly as the agent returned them")
+	flag.BoolVar(&rawFields, "no-trim", false, "alias for -raw-fields")
+	groupBy := flag.String("group-by", "", "group text and cards output under headings: date")
+	tz := flag.String("tz", "Local", "IANA time zone for published dates and -group-by date, e.g. Europe/Berlin")
+	colorMode := flag.String("color", colorAuto, "style output with ANSI colors: "+strings.Join(colorModes, ", "))
+	separator := flag.String("separator", "", `line printed between articles in text and cards output; escapes like \f are expanded (default an empty line)`)
+	mergeText := flag.Bool("merge-summary-excerpt", false, "show both summary and excerpt, or only the longer one when they are near-identical")
+	mergeThreshold := flag.Float64("merge-threshold", defaultMergeThreshold, "word overlap (0 to 1) above which -merge-summary-excerpt treats summary and excerpt as the same")
+	maxResponseSize := flag.Int64("max-response-size", 0, "maximum response body size in bytes (0 for no limit)")
+	sortOrder := flag.String("sort", sortBackend, "result order: "+strings.Join(sortOrders, ", "))
+	recencyWeight := flag.Float64("recency-weight", 0.5, "share of recency (0 to 1) in the -sort smart ranking")
+	scrubAcross := flag.Bool("scrub-duplicates-across-queries", false, "suppress articles already shown by an earlier query in this run")
+	scrubKey := flag.String("scrub-key", scrubKeyURL, "how -scrub-duplicates-across-queries identifies an article: url or title")
+	timeoutScale := flag.Float64("timeout-scale", 1.0, "multiplier applied to every timeout, e.g. 2 on slow networks")
+	indexSize := flag.Int("index-size", 1000, "maximum articles kept for search-local (0 disables the index)")
+	indexFile := flag.String("index-file", "", "file used to persist the search-local index between runs")
+	maxLimitHeader := flag.String("max-limit-header", "X-Max-Limit", "response header carrying the server's maximum limit (empty to ignore)")
+	strictLimit := flag.Bool("strict-limit", false, "treat a limit capped by the server as an error")
+	useHTTP2 := flag.Bool("http2", true, "negotiate HTTP/2 with TLS agents (false forces HTTP/1.1)")
+	statsFile := flag.String("stats-file", "", "write run statistics as JSON to this file on exit")
+	dedupeWindow := flag.Duration("dedupe-window", 0, "forget articles suppressed by -scrub-duplicates-across-queries after this long (0 keeps them for the whole run)")
+	locale := flag.String("locale", "", "BCP 47 language tag used to format numbers in text output, e.g. de-DE")
+	payloadOnly := flag.Bool("print-payload-only", false, "print the JSON payload each query would send instead of sending it")
+	dedupeReport := flag.Bool("dedupe-report", false, "after text and cards output, list the duplicates -merge-backends and -min-sources collapsed")
+	baseline := flag.Bool("baseline", false, "after each query, compare its average sentiment with the same query on recent days")
+	baselineDays := flag.Int("baseline-days", 7, "number of earlier days averaged for -baseline")
+	statePath := flag.String("state-file", defaultStatePath(), "file keeping the daily sentiment averages used by -baseline")
+	transform := flag.String("transform", "", "command that receives each query's results as a JSON array on stdin and prints the array to show instead")
+	analyzeText := flag.String("analyze-text", "", "show the agent's sentiment and summary of this text and exit (- reads stdin)")
+	retries := flag.Int("retries", 0, "times to retry a query whose response was cut off mid-body")
+	traceRequests := flag.Bool("trace", false, "log a timing breakdown (DNS, connect, TLS, TTFB, body) of every query; implied by -v")
+	strictErrors := flag.Bool("strict-errors", false, "in interactive mode, exit with status 1 on the first failed query")
+	webhookURL := flag.String("webhook", "", "POST each query's results as JSON to this URL")
+	var webhookHeaders headerList
+	flag.Var(&webhookHeaders, "webhook-header", `extra "Name: value" header for -webhook requests (repeatable)`)
+	webhookIfNegative := flag.Bool("webhook-if-negative", false, "only call -webhook when a result is negative")
+	webhookIfNonEmpty := flag.Bool("webhook-if-nonempty", false, "only call -webhook when there are results")
+	sourceRename := flag.String("source-rename", "", "display names for sources, e.g. www.example.com=Example News,ft.com=FT")
+	fieldMap := flag.String("field-map", "", "rename output fields in tsv output, e.g. title=headline,sentiment=mood")
+	credentialHelper := flag.String("credential-helper", "", "command printing {\"base_url\", \"token\"} JSON used to reach the agent")
+	concurrency := flag.Int("concurrency", 4, "maximum queries run at once for semicolon-separated topics")
+	format := flag.String("format", formatText, "output format: "+strings.Join(outputFormats, ", "))
+	repeat := flag.Int("repeat", 1, "number of times to run a one-shot query")
+	interval := flag.Duration("interval", time.Minute, "delay between -repeat runs")
+	setup := flag.Bool("setup", false, "interactively write the config file (base URL, token, limit, format) and exit")
+	configPath := flag.String("config", defaultConfigPath(), "config file supplying defaults for -base, -limit, -format and the token")
 	flag.Parse()
 
-	client := newAgentClient(*baseURL, *timeout)
+	if *timeoutScale <= 0 {
+		fmt.Fprintln(os.Stderr, "-timeout-scale must be positive")
+		os.Exit(2)
+	}
+	// Scale once here so every path that reads the timeout (HTTP client,
+	// per-query contexts, warmup, probes and helpers) sees the same value.
+	*timeout = time.Duration(float64(*timeout) * *timeoutScale)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+		os.Exit(2)
+	}
+	if *setup {
+		defaults := cfg
+		if defaults.BaseURL == "" {
+			defaults.BaseURL = *baseURL
+		}
+		if defaults.Limit == 0 {
+			defaults.Limit = *limit
+		}
+		if defaults.Format == "" {
+			defaults.Format = *format
+		}
+		if err := runSetup(*configPath, defaults, *timeout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if err := cfg.applyFlags(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+		os.Exit(2)
+	}
+
+	if !validFormat(*format) {
+		fmt.Fprintf(os.Stderr, "unknown -format %q (want one of %s)\n", *format, strings.Join(outputFormats, ", "))
+		os.Exit(2)
+	}
+	opts := displayOptions{
+		format:             *format,
+		collapseWhitespace: *collapse,
+		explainScore:       *explainScore,
+		indexTitles:        *indexTitles,
+		readingTime:        *readingTime,
+		rawFields:          rawFields,
+		mergeText:          *mergeText,
+		mergeThreshold:     *mergeThreshold,
+	}
+	sep, err := strconv.Unquote(`"` + strings.ReplaceAll(*separator, `"`, `\"`) + `"`)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -separator: %q has a bad escape sequence\n", *separator)
+		os.Exit(2)
+	}
+	opts.separator = sep
+	if *mergeThreshold < 0 || *mergeThreshold > 1 {
+		fmt.Fprintf(os.Stderr, "invalid -merge-threshold: %v is not between 0 and 1\n", *mergeThreshold)
+		os.Exit(2)
+	}
+	opts.terminal, opts.width = terminalWidth(os.Stdout)
+	if *groupBy != "" && *groupBy != groupDate {
+		fmt.Fprintf(os.Stderr, "unknown -group-by %q (want %s)\n", *groupBy, groupDate)
+		os.Exit(2)
+	}
+	opts.groupBy = *groupBy
+	if opts.location, err = time.LoadLocation(*tz); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -tz: %v\n", err)
+		os.Exit(2)
+	}
+	if opts.color, err = useColor(*colorMode, opts.terminal); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -color: %v\n", err)
+		os.Exit(2)
+	}
+	bands, err := parseScoreBands(*scoreBands)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -score-bands: %v\n", err)
+		os.Exit(2)
+	}
+	opts.scoreBands = bands
+	if *locale != "" {
+		tag, err := language.Parse(*locale)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -locale: %v\n", err)
+			os.Exit(2)
+		}
+		opts.numbers = message.NewPrinter(tag)
+	}
+	if opts.fieldMap, err = parseFieldMap(*fieldMap); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -field-map: %v\n", err)
+		os.Exit(2)
+	}
+	if opts.sourceNames, err = parseSourceRename(*sourceRename); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -source-rename: %v\n", err)
+		os.Exit(2)
+	}
+	if *tagsFile != "" {
+		tags, err := loadSourceTags(*tagsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load tags file: %v\n", err)
+			os.Exit(2)
+		}
+		opts.tags = tags
+	}
+
+	var jqCode *gojq.Code
+	if *jqExpr != "" {
+		code, err := compileJQ(*jqExpr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -jq expression: %v\n", err)
+			os.Exit(2)
+		}
+		jqCode = code
+	}
+
+	var matchRE, rejectRE *regexp.Regexp
+	if *matchRegex != "" {
+		if matchRE, err = regexp.Compile(*matchRegex); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -match-regex: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if *rejectRegex != "" {
+		if rejectRE, err = regexp.Compile(*rejectRegex); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -reject-regex: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	if !validSort(*sortOrder) {
+		fmt.Fprintf(os.Stderr, "unknown -sort %q (want one of %s)\n", *sortOrder, strings.Join(sortOrders, ", "))
+		os.Exit(2)
+	}
+	if *retries < 0 {
+		fmt.Fprintf(os.Stderr, "invalid -retries: %d is negative\n", *retries)
+		os.Exit(2)
+	}
+	if err := validRecencyWeight(*recencyWeight); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -recency-weight: %v\n", err)
+		os.Exit(2)
+	}
+
+	var seen *seenSet
+	if *scrubAcross {
+		if seen, err = newSeenSet(*scrubKey, *dedupeWindow); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -scrub-duplicates-across-queries options: %v\n", err)
+			os.Exit(2)
+		}
+	} else if *dedupeWindow != 0 {
+		fmt.Fprintln(os.Stderr, "-dedupe-window requires -scrub-duplicates-across-queries")
+		os.Exit(2)
+	}
+
+	if *queryParam == "" || *limitParam == "" || *queryParam == *limitParam {
+		fmt.Fprintln(os.Stderr, "-query-param and -limit-param must be non-empty and distinct")
+		os.Exit(2)
+	}
+
+	var creds credentials
+	if *credentialHelper != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		creds, err = runCredentialHelper(ctx, *credentialHelper)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "credential helper failed: %v\n", err)
+			os.Exit(2)
+		}
+		if creds.BaseURL != "" && !flagSet("base") {
+			*baseURL = creds.BaseURL
+		}
+	}
+
+	bases := splitList(*baseURL)
+	if len(bases) == 0 {
+		bases = []string{defaultBaseURL}
+	}
+	if len(bases) > 1 && !*mergeBackends {
+		fmt.Fprintln(os.Stderr, "multiple -base URLs require -merge-backends")
+		os.Exit(2)
+	}
+	newClient := func(base string) *agentClient {
+		c := newAgentClient(base, *timeout)
+		c.httpClient.Transport = newTransport(*useHTTP2, *concurrency)
+		c.queryParam = *queryParam
+		c.limitParam = *limitParam
+		c.verbose = *verbose
+		c.trace = *traceRequests || *verbose
+		c.token = creds.tokenFor(base, bases[0])
+		if c.token == "" {
+			c.token = cfg.tokenFor(base)
+		}
+		if c.token == "" && (creds.Token != "" || cfg.Token != "") {
+			c.debugf("sending no token to %s, which it was not issued for", backendLabel(c))
+		}
+		c.retries = *retries
+		c.retryDelay = time.Duration(float64(retryDelay) * *timeoutScale)
+		c.maxResponseSize = *maxResponseSize
+		c.maxLimitHeader = *maxLimitHeader
+		c.strictLimit = *strictLimit
+		c.onLimitCapped = func(requested, capped int) {
+			fmt.Fprintf(os.Stderr, "Note: %s capped the limit of %d to %d\n", backendLabel(c), requested, capped)
+		}
+		return c
+	}
+	client := newClient(bases[0])
+	var backends []*agentClient
+	if *mergeBackends {
+		for _, base := range bases {
+			backends = append(backends, newClient(base))
+		}
+	}
+
+	if *warmup && !*payloadOnly {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		if err := client.Warmup(ctx); err != nil && *verbose {
+			fmt.Fprintf(os.Stderr, "warmup failed: %v\n", err)
+		}
+		cancel()
+	}
+
+	// Capabilities are probed lazily by the features that need them; only
+	// -v asks up front, to report the agent version.
+	if *verbose && !*payloadOnly {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		caps, err := client.Capabilities(ctx)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "capability probe failed, assuming baseline: %v\n", err)
+		}
+		fmt.Fprintf(os.Stderr, "agent %s\n", caps)
+	}
+
+	var hook *webhook
+	if *webhookURL != "" {
+		hook = newWebhook(*webhookURL, webhookHeaders, *timeout)
+		hook.ifNegative = *webhookIfNegative
+		hook.ifNonEmpty = *webhookIfNonEmpty
+		hook.verbose = *verbose
+	}
+
+	var stats *runStats
+	if *statsFile != "" {
+		stats = newRunStats()
+	}
+
+	var index *localIndex
+	if *indexSize > 0 {
+		index = newLocalIndex(*indexSize)
+		if *indexFile != "" {
+			if err := index.load(*indexFile); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to load index file: %v\n", err)
+				os.Exit(2)
+			}
+		}
+	}
+
+	var trend *sentimentHistory
+	if *baseline {
+		if *statePath == "" {
+			fmt.Fprintln(os.Stderr, "-baseline needs -state-file")
+			os.Exit(2)
+		}
+		if *baselineDays < 1 {
+			fmt.Fprintln(os.Stderr, "-baseline-days must be at least 1")
+			os.Exit(2)
+		}
+		trend = newSentimentHistory(*baselineDays, opts.location)
+		if err := trend.load(*statePath); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load state file: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	sess := &session{
+		client:       client,
+		backends:     backends,
+		out:          os.Stdout,
+		jq:           jqCode,
+		matchRE:      matchRE,
+		rejectRE:     rejectRE,
+		emptyMessage: *emptyMessage,
+		verbose:      *verbose,
+		concurrency:  *concurrency,
+		seen:         seen,
+		stats:        stats,
+		index:        index,
+		payloadOnly:  *payloadOnly,
+		webhook:      hook,
+		dedupeReport: *dedupeReport,
+		transform:    *transform,
+		trend:        trend,
+		settings: settings{
+			limit:         *limit,
+			timeout:       *timeout,
+			minSources:    *minSources,
+			sort:          *sortOrder,
+			recencyWeight: *recencyWeight,
+			display:       opts,
+		},
+	}
+
+	// exit writes -index-file, -stats-file and the -baseline state, if
+	// any, before terminating with code.
+	exit := func(code int) {
+		if index != nil && *indexFile != "" {
+			if err := index.save(*indexFile); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to write index file: %v\n", err)
+			}
+		}
+		if stats != nil {
+			if err := stats.writeFile(*statsFile); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to write stats file: %v\n", err)
+			}
+		}
+		if trend != nil {
+			if err := trend.save(*statePath, time.Now()); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to write state file: %v\n", err)
+			}
+		}
+		os.Exit(code)
+	}
+	if stats != nil || (index != nil && *indexFile != "") || trend != nil {
+		interrupts := make(chan os.Signal, 1)
+		signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-interrupts
+			exit(130)
+		}()
+	}
+
+	if *analyzeText != "" {
+		text := *analyzeText
+		if text == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			text = string(data)
+		}
+		if err := sess.analyze(strings.TrimSpace(text)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		exit(0)
+	}
+
+	if flag.NArg() > 0 {
+		query := strings.TrimSpace(strings.Join(flag.Args(), " "))
+		if *repeat < 1 {
+			fmt.Fprintln(os.Stderr, "-repeat must be at least 1")
+			os.Exit(2)
+		}
+		if *payloadOnly {
+			if err := sess.printPayload(query); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			exit(0)
+		}
+		failed, empty := false, false
+		for i := 0; i < *repeat; i++ {
+			if i > 0 {
+				time.Sleep(*interval)
+			}
+			if *repeat > 1 {
+				fmt.Printf("=== %s ===\n", time.Now().Format(time.RFC3339))
+			}
+			n, err := sess.run(query)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				failed = true
+			} else if n == 0 {
+				empty = true
+			}
+		}
+		switch {
+		case failed:
+			exit(1)
+		case empty:
+			exit(*emptyExitCode)
+		}
+		exit(0)
+	}
+
 	reader := bufio.NewScanner(os.Stdin)
 
 	fmt.Printf("News Agent CLI connected to %s\n", client.baseURL)
 	fmt.Println("Type your query and press enter. Type 'exit' or 'quit' to leave.")
+	fmt.Println("Type 'set' to list options or 'set <option> <value>' to change one, 'undo' to revert.")
+	fmt.Println("Type 'version-info' to show the agent version and features.")
+	fmt.Println("Separate topics with ';' to search several at once.")
+	fmt.Println("Type 'search-local <terms>' to search articles fetched so far without contacting the agent.")
+	fmt.Println("Type 'highlight <terms>' to mark extra terms in results, 'highlight off' to clear.")
+	fmt.Println("Type 'vs <query> | <query>' to compare the sentiment of two queries.")
+	fmt.Println("Type 'copy-all' to copy the latest results, in the current format, to the clipboard.")
+	fmt.Println("Type 'analyze <text>' to get the agent's sentiment and summary of a snippet.")
 
 	for {
 		fmt.Print("\n> ")
@@ -127,38 +993,1092 @@ func main() {
 		if strings.EqualFold(query, "exit") || strings.EqualFold(query, "quit") {
 			break
 		}
-
-		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
-		items, err := client.Query(ctx, query, *limit)
-		cancel()
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
+		if strings.EqualFold(query, "version-info") {
+			ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+			caps, err := client.Capabilities(ctx)
+			cancel()
+			if err != nil {
+				fmt.Printf("Capability probe failed, assuming baseline: %v\n", err)
+			}
+			fmt.Printf("Agent %s\n", caps)
 			continue
 		}
-		if len(items) == 0 {
-			fmt.Println("No articles found.")
+		if cmd, args, _ := strings.Cut(query, " "); strings.EqualFold(cmd, "set") {
+			if err := sess.set(strings.TrimSpace(args)); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 			continue
 		}
-		for idx, item := range items {
-			fmt.Printf("\n[%d] %s\n", idx+1, item.Title)
-			fmt.Printf("    Source: %s\n", item.Source)
-			if published := formatPublished(item.PublishedAt); published != "" {
-				fmt.Printf("    Published: %s\n", published)
+		if cmd, terms, _ := strings.Cut(query, " "); strings.EqualFold(cmd, "search-local") {
+			if err := sess.searchLocal(strings.TrimSpace(terms)); err != nil {
+				fmt.Printf("Error: %v\n", err)
 			}
-			fmt.Printf("    Sentiment: %s (%.2f)\n", formatSentiment(item.Sentiment), item.SentimentScore)
-			if item.Summary != "" {
-				fmt.Printf("    Summary: %s\n", item.Summary)
-			} else if item.Excerpt != "" {
-				fmt.Printf("    Excerpt: %s\n", item.Excerpt)
+			continue
+		}
+		if cmd, terms, _ := strings.Cut(query, " "); strings.EqualFold(cmd, "highlight") {
+			if err := sess.setHighlight(strings.TrimSpace(terms)); err != nil {
+				fmt.Printf("Error: %v\n", err)
 			}
-			if item.URL != "" {
-				fmt.Printf("    URL: %s\n", item.URL)
+			continue
+		}
+		if cmd, args, _ := strings.Cut(query, " "); strings.EqualFold(cmd, "vs") {
+			failed, err := sess.compare(args)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+			if (err != nil || failed > 0) && *strictErrors {
+				exit(1)
+			}
+			continue
+		}
+		if cmd, text, _ := strings.Cut(query, " "); strings.EqualFold(cmd, "analyze") {
+			if err := sess.analyze(strings.TrimSpace(text)); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				if *strictErrors {
+					exit(1)
+				}
+			}
+			continue
+		}
+		if strings.EqualFold(query, "copy-all") {
+			if err := sess.copyAll(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+			continue
+		}
+		if strings.EqualFold(query, "undo") {
+			if err := sess.undo(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+			continue
+		}
+		topics := splitTopics(query)
+		if len(topics) == 0 {
+			continue
+		}
+		if len(topics) > 1 {
+			if sess.runTopics(topics) > 0 && *strictErrors {
+				exit(1)
+			}
+			continue
+		}
+		query = topics[0]
+		if _, err := sess.run(query); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			if *strictErrors {
+				exit(1)
 			}
 		}
 	}
+	exit(0)
+}
+
+// session holds the state shared by every query issued from one invocation,
+// whether one-shot or interactive.
+type session struct {
+	client *agentClient
+	// backends, when set, are all queried and their results merged instead
+	// of querying client alone.
+	backends []*agentClient
+	out      io.Writer
+	jq       *gojq.Code
+	settings settings
+	// matchRE and rejectRE filter articles on their title and summary.
+	matchRE  *regexp.Regexp
+	rejectRE *regexp.Regexp
+	// emptyMessage replaces the text listing when a query returns nothing.
+	emptyMessage string
+	verbose      bool
+	// concurrency bounds the queries runTopics has in flight.
+	concurrency int
+	// seen, when set, suppresses articles already shown during the run.
+	seen *seenSet
+	// stats collects run metrics for -stats-file; nil when disabled.
+	stats *runStats
+	// index holds every fetched article for search-local; nil when disabled.
+	index *localIndex
+	// trend, when set, records each query's average sentiment and prints
+	// it against the -baseline.
+	trend *sentimentHistory
+	// transform is a command that rewrites each query's results as JSON.
+	transform string
+	// dedupeReport lists the duplicates collapsed into each shown item
+	// after the results.
+	dedupeReport bool
+	// webhook, when set, receives the results of every query.
+	webhook *webhook
+	// payloadOnly prints the request payload for each query instead of
+	// sending it.
+	payloadOnly bool
+
+	// history holds the settings in effect before each `set`, for `undo`.
+	history settingsHistory
+	// last is the most recent result set as returned by the agent, kept so
+	// it can be shown again after the settings change.
+	last    []newsItem
+	hasLast bool
+}
+
+// run fetches query, renders the results to s.out and reports how many
+// articles were shown.
+func (s *session) run(query string) (int, error) {
+	if s.payloadOnly {
+		return 0, s.printPayload(query)
+	}
+	items, err := s.fetch(query)
+	if err != nil {
+		return 0, err
+	}
+	items = s.scrub(items)
+	s.last, s.hasLast = items, true
+	shown, err := s.present(items)
+	s.stats.recordShown(shown)
+	s.notify(query, shown)
+	s.compareBaseline(query, shown)
+	return len(shown), err
+}
+
+// compareBaseline prints the average sentiment of shown against the
+// -baseline and records it for later runs.
+func (s *session) compareBaseline(query string, shown []newsItem) {
+	if s.trend == nil || len(shown) == 0 {
+		return
+	}
+	now := time.Now()
+	if humanFormat(s.settings.display.format) && s.jq == nil {
+		fmt.Fprintf(s.out, "\n%s\n", s.trend.annotation(query, shown, now, s.settings.display))
+	}
+	s.trend.record(query, shown, now)
+}
+
+// notify posts the shown results to the -webhook, if any. Webhook failures
+// are reported but never fail the query.
+func (s *session) notify(query string, shown []newsItem) {
+	if s.webhook == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.settings.timeout)
+	defer cancel()
+	if err := s.webhook.send(ctx, query, shown); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: webhook failed: %v\n", err)
+	}
 }
 
-func formatPublished(value string) string {
+// printPayload writes the JSON body Query would send for query.
+func (s *session) printPayload(query string) error {
+	data, err := json.MarshalIndent(s.client.payload(query, s.settings.limit), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "%s\n", data)
+	return err
+}
+
+// scrub drops articles already shown earlier in the run when
+// -scrub-duplicates-across-queries is on, noting how many were dropped.
+// The note goes to stderr for machine-readable output.
+func (s *session) scrub(items []newsItem) []newsItem {
+	if s.seen == nil {
+		return items
+	}
+	items, suppressed := s.seen.filter(items, time.Now())
+	if suppressed > 0 {
+		note := s.out
+		if s.jq != nil || !humanFormat(s.settings.display.format) {
+			note = os.Stderr
+		}
+		fmt.Fprintf(note, "(%d already shown earlier in this run, suppressed)\n", suppressed)
+	}
+	return items
+}
+
+// fetch queries the agent with its own per-query timeout.
+func (s *session) fetch(query string) ([]newsItem, error) {
+	start := time.Now()
+	items, err := s.fetchItems(query)
+	s.stats.recordQuery(time.Since(start), len(items), err)
+	if err == nil && s.transform != "" {
+		items = s.transformItems(items)
+	}
+	s.index.add(items)
+	return items, err
+}
+
+// transformItems runs items through the -transform command, keeping the
+// originals if it fails or returns something other than a list of articles.
+func (s *session) transformItems(items []newsItem) []newsItem {
+	ctx, cancel := context.WithTimeout(context.Background(), s.settings.timeout)
+	defer cancel()
+	transformed, err := runTransform(ctx, s.transform, items)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: -transform failed, showing untransformed results: %v\n", err)
+		return items
+	}
+	return transformed
+}
+
+func (s *session) fetchItems(query string) ([]newsItem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.settings.timeout)
+	defer cancel()
+	if len(s.backends) == 0 {
+		return s.client.Query(ctx, query, s.settings.limit)
+	}
+	items, errs := queryBackends(ctx, s.backends, query, s.settings.limit)
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "Warning: backend %s failed: %v\n", backendLabel(s.backends[i]), err)
+		}
+	}
+	if failed == len(s.backends) {
+		return nil, fmt.Errorf("all %d backends failed", failed)
+	}
+	return items, nil
+}
+
+// topicResult is the outcome of one query issued by runTopics.
+type topicResult struct {
+	items []newsItem
+	err   error
+}
+
+// runTopics fetches every topic concurrently, at most s.concurrency at a
+// time, then shows each topic's results or error in the order given. It
+// returns the number of topics that failed.
+func (s *session) runTopics(topics []string) int {
+	failed := 0
+	if s.payloadOnly {
+		for _, topic := range topics {
+			fmt.Fprintf(s.out, "\n=== %s ===\n", topic)
+			if err := s.printPayload(topic); err != nil {
+				fmt.Fprintf(s.out, "Error: %v\n", err)
+				failed++
+			}
+		}
+		return failed
+	}
+	results := make([]topicResult, len(topics))
+	workers := s.concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, topic := range topics {
+		wg.Add(1)
+		go func(i int, topic string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			items, err := s.fetch(topic)
+			results[i] = topicResult{items: items, err: err}
+		}(i, topic)
+	}
+	wg.Wait()
+
+	// The results of several topics cannot be redisplayed as one set.
+	s.last, s.hasLast = nil, false
+	for i, topic := range topics {
+		fmt.Fprintf(s.out, "\n=== %s ===\n", topic)
+		if err := results[i].err; err != nil {
+			fmt.Fprintf(s.out, "Error: %v\n", err)
+			failed++
+			continue
+		}
+		shown, err := s.present(s.scrub(results[i].items))
+		s.stats.recordShown(shown)
+		s.notify(topic, shown)
+		s.compareBaseline(topic, shown)
+		if err != nil {
+			fmt.Fprintf(s.out, "Error: %v\n", err)
+			failed++
+		}
+	}
+	return failed
+}
+
+// splitTopics splits an interactive line on semicolons, dropping empty
+// topics.
+func splitTopics(line string) []string {
+	var topics []string
+	for _, topic := range strings.Split(line, ";") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// set runs the interactive `set` command, remembering the previous settings
+// when an option changes.
+func (s *session) set(args string) error {
+	previous := s.settings
+	if err := s.settings.apply(s.out, args); err != nil {
+		return err
+	}
+	if args != "" {
+		s.history.push(previous)
+	}
+	return nil
+}
+
+// setHighlight runs the `highlight` command: "off" clears the terms, no
+// argument lists them, and anything else replaces them with the given
+// space-separated terms. The latest results are shown again with the change.
+func (s *session) setHighlight(args string) error {
+	switch {
+	case args == "":
+		if s.settings.display.highlight == nil {
+			fmt.Fprintln(s.out, "No highlight terms set.")
+		} else {
+			fmt.Fprintf(s.out, "Highlighting: %s\n", strings.Join(s.settings.display.highlight.terms, " "))
+		}
+		return nil
+	case strings.EqualFold(args, "off"):
+		s.settings.display.highlight = nil
+		fmt.Fprintln(s.out, "Highlighting off.")
+	default:
+		s.settings.display.highlight = newHighlighter(strings.Fields(args))
+		fmt.Fprintf(s.out, "Highlighting: %s\n", strings.Join(s.settings.display.highlight.terms, " "))
+	}
+	if !s.settings.display.color {
+		fmt.Fprintln(s.out, "(highlighting only shows when -color is on)")
+	}
+	if !s.hasLast {
+		return nil
+	}
+	_, err := s.present(s.last)
+	return err
+}
+
+// searchLocal runs the `search-local` command against the session index.
+func (s *session) searchLocal(terms string) error {
+	if s.index == nil {
+		return errors.New("the local index is disabled (-index-size 0)")
+	}
+	if terms == "" {
+		return errors.New("usage: search-local <terms>")
+	}
+	items := s.index.search(terms, s.settings.limit)
+	if len(items) == 0 && humanFormat(s.settings.display.format) {
+		fmt.Fprintf(s.out, "No indexed articles match (%d indexed).\n", s.index.len())
+		return nil
+	}
+	return render(s.out, items, s.settings.display)
+}
+
+// analyze shows the agent's reading of text as a single pseudo-article, or
+// the payload it would send under -print-payload-only.
+func (s *session) analyze(text string) error {
+	if text == "" {
+		return errors.New("usage: analyze <text>")
+	}
+	if s.payloadOnly {
+		data, err := json.MarshalIndent(analyzePayload(text), "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(s.out, "%s\n", data)
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.settings.timeout)
+	defer cancel()
+	item, err := s.client.AnalyzeText(ctx, text)
+	if err != nil {
+		return err
+	}
+	if item.Title == "" {
+		item.Title = "Text analysis"
+	}
+	if item.Source == "" {
+		item.Source = backendLabel(s.client)
+	}
+	if s.jq != nil {
+		return printJQ(s.out, s.jq, []newsItem{item})
+	}
+	return render(s.out, []newsItem{item}, s.settings.display)
+}
+
+// copyAll renders the latest results in the current format and puts them on
+// the system clipboard. Without a clipboard tool they are printed instead.
+func (s *session) copyAll() error {
+	if !s.hasLast {
+		return errors.New("no results to copy yet")
+	}
+	items := s.filter(s.last)
+	opts := s.settings.display
+	opts.plain = true
+	var buf bytes.Buffer
+	var err error
+	if s.jq != nil {
+		err = printJQ(&buf, s.jq, items)
+	} else {
+		err = render(&buf, items, opts)
+	}
+	if err != nil {
+		return err
+	}
+	data := bytes.TrimLeft(buf.Bytes(), "\n")
+	if err := copyToClipboard(data); err != nil {
+		if !errors.Is(err, errNoClipboard) {
+			return err
+		}
+		fmt.Fprintf(s.out, "%v; printing the results instead.\n\n", err)
+		_, err = s.out.Write(data)
+		return err
+	}
+	fmt.Fprintf(s.out, "Copied %d articles (%d bytes) to the clipboard.\n", len(items), len(data))
+	return nil
+}
+
+// undo restores the settings in effect before the last `set` and shows the
+// latest result set again under them.
+func (s *session) undo() error {
+	previous, ok := s.history.pop()
+	if !ok {
+		return errors.New("nothing to undo")
+	}
+	s.settings = previous
+	fmt.Fprintln(s.out, "Restored previous settings.")
+	if !s.hasLast {
+		return nil
+	}
+	_, err := s.present(s.last)
+	return err
+}
+
+// present filters items according to the session settings and renders
+// them, returning the articles that were shown and recording them for
+// -scrub-duplicates-across-queries. Machine-readable output is
+// still written for an empty result set so downstream parsers see a valid,
+// empty document.
+func (s *session) present(items []newsItem) ([]newsItem, error) {
+	items = s.filter(items)
+	if s.seen != nil {
+		s.seen.record(items, time.Now())
+	}
+	if s.jq != nil {
+		return items, printJQ(s.out, s.jq, items)
+	}
+	if len(items) == 0 && humanFormat(s.settings.display.format) {
+		if s.emptyMessage != "" {
+			fmt.Fprintln(s.out, s.emptyMessage)
+		}
+		return nil, nil
+	}
+	if err := render(s.out, items, s.settings.display); err != nil {
+		return items, err
+	}
+	if s.dedupeReport && humanFormat(s.settings.display.format) {
+		printDedupeReport(s.out, items, s.settings.display)
+	}
+	return items, nil
+}
+
+// filter applies the regex filters, -min-sources and -sort to items.
+func (s *session) filter(items []newsItem) []newsItem {
+	if s.matchRE != nil || s.rejectRE != nil {
+		var unmatched, rejected int
+		items, unmatched, rejected = filterRegex(items, s.matchRE, s.rejectRE)
+		if s.verbose {
+			fmt.Fprintf(os.Stderr, "regex filters removed %d unmatched and %d rejected articles\n", unmatched, rejected)
+		}
+	}
+	if s.settings.minSources > 1 {
+		items = corroborated(items, s.settings.minSources)
+	}
+	if s.settings.sort == sortSmart {
+		items = smartSort(items, s.settings.recencyWeight, time.Now())
+	}
+	if display := s.settings.display; display.groupBy == groupDate && humanFormat(display.format) && s.jq == nil {
+		items = groupByDay(items, display.location)
+	}
+	return items
+}
+
+// Output formats accepted by -format.
+const (
+	formatText  = "text"
+	formatCards = "cards"
+	formatTSV   = "tsv"
+)
+
+var outputFormats = []string{formatText, formatCards, formatTSV}
+
+// humanFormat reports whether format is meant for reading rather than for
+// other programs.
+func humanFormat(format string) bool {
+	return format == formatText || format == formatCards
+}
+
+func validFormat(name string) bool {
+	for _, f := range outputFormats {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// displayOptions controls how a result set is rendered.
+type displayOptions struct {
+	format             string
+	tags               sourceTags
+	collapseWhitespace bool
+	// groupBy, when "date", puts day headings between articles; the items
+	// must be ordered with groupByDay.
+	groupBy string
+	// location is the time zone used for published dates and day groups.
+	location *time.Location
+	// color enables ANSI styling: sentiment lines are colored by score and
+	// -highlight terms are marked.
+	color bool
+	// plain drops the escape codes color would add but keeps the layout it
+	// selects, for copies of what is on screen.
+	plain bool
+	// separator is the line printed between articles in human-readable
+	// formats; the default is an empty line.
+	separator string
+	// mergeText shows both summary and excerpt unless their word overlap
+	// exceeds mergeThreshold, in which case only the longer one is shown.
+	mergeText      bool
+	mergeThreshold float64
+	// terminal reports whether output goes to a terminal of the given
+	// width; layouts that only make sense on screen fall back otherwise.
+	terminal bool
+	width    int
+	// explainScore adds a plain-language reading of each score using
+	// scoreBands.
+	explainScore bool
+	scoreBands   []scoreBand
+	// indexTitles adds the 1-based result index to formats that do not
+	// number results already. The text listing always shows it.
+	indexTitles bool
+	readingTime bool
+	// rawFields prints the agent's strings verbatim, skipping sentiment
+	// casing, date reformatting and whitespace collapsing.
+	rawFields bool
+	// fieldMap renames export columns in machine-readable formats.
+	fieldMap map[string]string
+	// sourceNames maps lower-cased sources to the names shown and exported
+	// in their place.
+	sourceNames map[string]string
+	// highlight marks extra terms in human-readable formats.
+	highlight *highlighter
+	// numbers formats numbers in human-readable formats for -locale;
+	// machine-readable formats always use a period as decimal separator.
+	numbers *message.Printer
+}
+
+// sprintf formats numbers for the configured -locale, or like fmt.Sprintf
+// when none is set.
+func (o displayOptions) sprintf(format string, args ...any) string {
+	if o.numbers == nil {
+		return fmt.Sprintf(format, args...)
+	}
+	return o.numbers.Sprintf(format, args...)
+}
+
+// activeHighlighter returns the highlighter to use, or nil when color is off,
+// by default because escape codes would end up in files or pipes.
+func (o displayOptions) activeHighlighter() *highlighter {
+	if !o.color || o.plain {
+		return nil
+	}
+	return o.highlight
+}
+
+// lineStyle returns the ANSI style for a detail line of item: sentiment lines
+// are colored by score when color is on.
+func (o displayOptions) lineStyle(item newsItem, line string) string {
+	if !o.color || o.plain || !strings.HasPrefix(line, "Sentiment: ") {
+		return ""
+	}
+	return sentimentStyle(item.SentimentScore)
+}
+
+// sourceName returns the display name of item's source under
+// -source-rename, or the source unchanged when it has no mapping.
+func (o displayOptions) sourceName(item newsItem) string {
+	if name, ok := o.sourceNames[strings.ToLower(strings.TrimSpace(item.Source))]; ok {
+		return name
+	}
+	return item.Source
+}
+
+// fieldName returns the output name of an export field after -field-map.
+func (o displayOptions) fieldName(field string) string {
+	if name, ok := o.fieldMap[field]; ok {
+		return name
+	}
+	return field
+}
+
+// render writes items to w in the configured format.
+func render(w io.Writer, items []newsItem, opts displayOptions) error {
+	switch opts.format {
+	case formatCards:
+		if !opts.terminal || !opts.color {
+			printItems(w, items, opts)
+			return nil
+		}
+		printCards(w, items, opts)
+		return nil
+	case formatTSV:
+		return writeTSV(w, items, opts)
+	default:
+		printItems(w, items, opts)
+		return nil
+	}
+}
+
+func printItems(w io.Writer, items []newsItem, opts displayOptions) {
+	hl := opts.activeHighlighter()
+	now := time.Now()
+	fmt.Fprintln(w)
+	for idx, item := range items {
+		opts.writeBreak(w, items, idx, now)
+		fmt.Fprintf(w, "[%d] %s\n", idx+1, hl.apply(item.Title))
+		for _, line := range itemDetails(item, opts) {
+			fmt.Fprintf(w, "    %s\n", styleLine(hl.apply(line), opts.lineStyle(item, line)))
+		}
+	}
+}
+
+// itemDetails returns the labelled lines shown under an item's title by the
+// human-readable formats.
+func itemDetails(item newsItem, opts displayOptions) []string {
+	var lines []string
+	source := item.Source
+	if !opts.rawFields {
+		source = opts.sourceName(item)
+	}
+	if tags := opts.tags.lookup(item); len(tags) > 0 {
+		source += " [" + strings.Join(tags, ", ") + "]"
+	}
+	lines = append(lines, "Source: "+source)
+	if item.coverage > 1 {
+		lines = append(lines, opts.sprintf("Covered by %d sources", item.coverage))
+	}
+	if item.backend != "" {
+		lines = append(lines, "Backend: "+item.backend)
+	}
+	published, sentiment := formatPublished(item.PublishedAt, opts.location), formatSentiment(item.Sentiment)
+	score := opts.sprintf("%.2f", item.SentimentScore)
+	if opts.rawFields {
+		published, sentiment = item.PublishedAt, item.Sentiment
+		score = strconv.FormatFloat(item.SentimentScore, 'f', -1, 64)
+	}
+	if published != "" {
+		lines = append(lines, "Published: "+published)
+	}
+	if label := explainScore(opts.scoreBands, item.SentimentScore); opts.explainScore && label != "" {
+		lines = append(lines, fmt.Sprintf("Sentiment: %s (%s, %s)", sentiment, score, label))
+	} else {
+		lines = append(lines, fmt.Sprintf("Sentiment: %s (%s)", sentiment, score))
+	}
+	summary, excerpt := item.Summary, item.Excerpt
+	if opts.collapseWhitespace && !opts.rawFields {
+		summary, excerpt = collapseWhitespace(summary), collapseWhitespace(excerpt)
+	}
+	switch {
+	case opts.mergeText && summary != "" && excerpt != "":
+		if jaccard(summary, excerpt) <= opts.mergeThreshold {
+			lines = append(lines, "Summary: "+summary, "Excerpt: "+excerpt)
+		} else if len(excerpt) > len(summary) {
+			lines = append(lines, "Excerpt: "+excerpt)
+		} else {
+			lines = append(lines, "Summary: "+summary)
+		}
+	case summary != "":
+		lines = append(lines, "Summary: "+summary)
+	case excerpt != "":
+		lines = append(lines, "Excerpt: "+excerpt)
+	}
+	if opts.readingTime {
+		if estimate := readingTime(item); estimate != "" {
+			lines = append(lines, "Reading time: "+estimate)
+		}
+	}
+	if item.URL != "" {
+		lines = append(lines, "URL: "+item.URL)
+	}
+	return lines
+}
+
+// indexColumn names the column -prepend-index-to-title adds to tabular
+// exports.
+const indexColumn = "index"
+
+// exportFields lists the columns, in order, written by the tabular exporters.
+var exportFields = []string{"title", "source", "published_at", "sentiment", "sentiment_score", "url", "summary", "excerpt"}
+
+// parseFieldMap parses "field=name" pairs that rename export columns. Source
+// fields must be known export fields and no two columns may end up with the
+// same name.
+func parseFieldMap(spec string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, pair := range splitList(spec) {
+		from, to, ok := strings.Cut(pair, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("%q is not field=name", pair)
+		}
+		known := false
+		for _, field := range exportFields {
+			known = known || field == from
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown field %q (want one of %s)", from, strings.Join(exportFields, ", "))
+		}
+		if _, dup := mapping[from]; dup {
+			return nil, fmt.Errorf("field %q mapped twice", from)
+		}
+		if to == indexColumn {
+			return nil, fmt.Errorf("%q is reserved for the -prepend-index-to-title column", indexColumn)
+		}
+		mapping[from] = to
+	}
+	names := make(map[string]string)
+	for _, field := range exportFields {
+		name := field
+		if to, ok := mapping[field]; ok {
+			name = to
+		}
+		if other, dup := names[name]; dup {
+			return nil, fmt.Errorf("fields %q and %q would both be named %q", other, field, name)
+		}
+		names[name] = field
+	}
+	return mapping, nil
+}
+
+// exportRow returns item's values in exportFields order, unformatted.
+func exportRow(item newsItem, opts displayOptions) []string {
+	return []string{
+		item.Title,
+		opts.sourceName(item),
+		item.PublishedAt,
+		item.Sentiment,
+		strconv.FormatFloat(item.SentimentScore, 'f', -1, 64),
+		item.URL,
+		item.Summary,
+		item.Excerpt,
+	}
+}
+
+// parseSourceRename parses comma-separated "source=name" pairs. Sources
+// match case-insensitively.
+func parseSourceRename(spec string) (map[string]string, error) {
+	names := make(map[string]string)
+	for _, pair := range splitList(spec) {
+		from, to, ok := strings.Cut(pair, "=")
+		from, to = strings.ToLower(strings.TrimSpace(from)), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("%q is not source=name", pair)
+		}
+		if _, dup := names[from]; dup {
+			return nil, fmt.Errorf("source %q renamed twice", from)
+		}
+		names[from] = to
+	}
+	return names, nil
+}
+
+// tsvReplacer blanks out the characters TSV cannot escape.
+var tsvReplacer = strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ")
+
+// writeTSV writes a header row followed by one tab-separated row per item.
+// TSV has no quoting, so tabs and line breaks inside fields become spaces.
+func writeTSV(w io.Writer, items []newsItem, opts displayOptions) error {
+	header := make([]string, len(exportFields))
+	for i, field := range exportFields {
+		header[i] = opts.fieldName(field)
+	}
+	if opts.indexTitles {
+		header = append([]string{indexColumn}, header...)
+	}
+	if _, err := fmt.Fprintln(w, strings.Join(header, "\t")); err != nil {
+		return err
+	}
+	for idx, item := range items {
+		row := exportRow(item, opts)
+		for i, field := range row {
+			row[i] = tsvReplacer.Replace(field)
+		}
+		if opts.indexTitles {
+			row = append([]string{strconv.Itoa(idx + 1)}, row...)
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readingTime estimates how long item takes to read at wordsPerMinute. Only
+// the summary or excerpt is available, so the estimate says which it used.
+func readingTime(item newsItem) string {
+	text, basis := item.Summary, "summary"
+	if text == "" {
+		text, basis = item.Excerpt, "excerpt"
+	}
+	words := len(strings.Fields(text))
+	if words == 0 {
+		return ""
+	}
+	minutes := (words + wordsPerMinute - 1) / wordsPerMinute
+	return fmt.Sprintf("~%d min (estimated from %s)", minutes, basis)
+}
+
+// scoreBand labels sentiment scores at or above min.
+type scoreBand struct {
+	min   float64
+	label string
+}
+
+// parseScoreBands parses "threshold:label" pairs such as
+// "-0.2:negative,0.2:positive" into bands sorted by threshold.
+func parseScoreBands(spec string) ([]scoreBand, error) {
+	var bands []scoreBand
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		threshold, label, ok := strings.Cut(part, ":")
+		label = strings.TrimSpace(label)
+		if !ok || label == "" {
+			return nil, fmt.Errorf("%q is not threshold:label", part)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(threshold), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", part, err)
+		}
+		bands = append(bands, scoreBand{min: value, label: label})
+	}
+	if len(bands) == 0 {
+		return nil, errors.New("no bands given")
+	}
+	sort.Slice(bands, func(i, j int) bool { return bands[i].min < bands[j].min })
+	return bands, nil
+}
+
+// explainScore returns the label of the highest band whose threshold score
+// reaches. Scores below every threshold fall into the lowest band.
+func explainScore(bands []scoreBand, score float64) string {
+	if len(bands) == 0 {
+		return ""
+	}
+	label := bands[0].label
+	for _, band := range bands {
+		if score < band.min {
+			break
+		}
+		label = band.label
+	}
+	return label
+}
+
+// filterRegex keeps the items whose title and summary match match (when set)
+// and do not match reject (when set). It also reports how many items each
+// expression removed.
+func filterRegex(items []newsItem, match, reject *regexp.Regexp) (kept []newsItem, unmatched, rejected int) {
+	for _, item := range items {
+		text := item.Title + "\n" + item.Summary
+		if match != nil && !match.MatchString(text) {
+			unmatched++
+			continue
+		}
+		if reject != nil && reject.MatchString(text) {
+			rejected++
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept, unmatched, rejected
+}
+
+// collapseWhitespace replaces every run of Unicode whitespace, including
+// newlines, with a single space.
+func collapseWhitespace(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// jaccard returns the share of distinct words two texts have in common,
+// from 0 (none) to 1 (the same words).
+func jaccard(a, b string) float64 {
+	words := make(map[string]bool)
+	for _, word := range tokenize(a) {
+		words[word] = true
+	}
+	union := len(words)
+	shared := 0
+	seen := make(map[string]bool)
+	for _, word := range tokenize(b) {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		if words[word] {
+			shared++
+		} else {
+			union++
+		}
+	}
+	if union == 0 {
+		return 1
+	}
+	return float64(shared) / float64(union)
+}
+
+// corroborated groups items whose titles normalize to the same text and
+// keeps one representative per group that is reported by at least
+// minSources distinct sources. Representatives keep the backend's order.
+func corroborated(items []newsItem, minSources int) []newsItem {
+	type cluster struct {
+		members []int
+		sources map[string]struct{}
+	}
+	var order []string
+	clusters := make(map[string]*cluster)
+	for idx, item := range items {
+		key := normalizeTitle(item.Title)
+		if key == "" {
+			continue
+		}
+		c, ok := clusters[key]
+		if !ok {
+			c = &cluster{sources: make(map[string]struct{})}
+			clusters[key] = c
+			order = append(order, key)
+		}
+		c.members = append(c.members, idx)
+		c.sources[strings.ToLower(strings.TrimSpace(item.Source))] = struct{}{}
+	}
+	var kept []newsItem
+	for _, key := range order {
+		c := clusters[key]
+		if len(c.sources) < minSources {
+			continue
+		}
+		item := items[c.members[0]]
+		item.coverage = len(c.sources)
+		for _, idx := range c.members[1:] {
+			item.absorbed = append(item.absorbed, absorb(items[idx])...)
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+// normalizeTitle reduces a headline to a comparison key: outlet suffixes such
+// as " - Reuters" or " | Wired" are dropped, letters are lower-cased, and
+// punctuation and runs of whitespace collapse to single spaces.
+func normalizeTitle(title string) string {
+	for _, sep := range []string{" - ", " | ", " — "} {
+		if idx := strings.LastIndex(title, sep); idx > 0 {
+			title = title[:idx]
+		}
+	}
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+			continue
+		}
+		space = true
+	}
+	return b.String()
+}
+
+// sourceTags maps lower-cased source names or URL hosts to user-defined tags.
+type sourceTags map[string][]string
+
+func loadSourceTags(path string) (sourceTags, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string][]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	tags := make(sourceTags, len(raw))
+	for key, values := range raw {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key != "" && len(values) > 0 {
+			tags[key] = values
+		}
+	}
+	return tags, nil
+}
+
+// lookup returns the tags for item, matching on the source name first and
+// falling back to the URL host (with or without a leading "www.").
+func (t sourceTags) lookup(item newsItem) []string {
+	if len(t) == 0 {
+		return nil
+	}
+	if tags, ok := t[strings.ToLower(strings.TrimSpace(item.Source))]; ok {
+		return tags
+	}
+	parsed, err := url.Parse(item.URL)
+	if err != nil || parsed.Hostname() == "" {
+		return nil
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if tags, ok := t[host]; ok {
+		return tags
+	}
+	return t[strings.TrimPrefix(host, "www.")]
+}
+
+func compileJQ(expr string) (*gojq.Code, error) {
+	query, err := gojq.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return gojq.Compile(query)
+}
+
+// printJQ runs the decoded items through code and writes every emitted value
+// as indented JSON, mirroring what `jq` would print.
+func printJQ(w io.Writer, code *gojq.Code, items []newsItem) error {
+	// gojq only understands plain JSON values, so round-trip through
+	// encoding/json to turn the structs into maps.
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	var input any
+	if err := json.Unmarshal(data, &input); err != nil {
+		return err
+	}
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			return nil
+		}
+		if err, ok := v.(error); ok {
+			return err
+		}
+		out, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", out)
+	}
+}
+
+func formatPublished(value string, loc *time.Location) string {
 	if value == "" {
 		return ""
 	}
@@ -166,7 +2086,29 @@ func formatPublished(value string) string {
 	if err != nil {
 		return value
 	}
-	return parsed.Local().Format(time.RFC1123)
+	return parsed.In(loc).Format(time.RFC1123)
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var list []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
 func envOrDefault(key, fallback string) string {
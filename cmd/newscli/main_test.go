@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPayloadKeys(t *testing.T) {
+	c := newAgentClient("http://agent.invalid", time.Second)
+	c.queryParam, c.limitParam = "q", "count"
+
+	got := c.payload("acme", 3)
+	if len(got) != 2 || got["q"] != "acme" || got["count"] != 3 {
+		t.Errorf("payload(acme, 3) = %v, want map[count:3 q:acme]", got)
+	}
+	if got := c.payload("acme", 0); len(got) != 1 || got["q"] != "acme" {
+		t.Errorf("payload(acme, 0) = %v, want map[q:acme]", got)
+	}
+}
+
+func TestQuerySendsConfiguredKeys(t *testing.T) {
+	var bodies []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		bodies = append(bodies, body)
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	c := newAgentClient(srv.URL, time.Second)
+	c.queryParam, c.limitParam = "q", "count"
+	for _, limit := range []int{4, 0} {
+		if _, err := c.Query(context.Background(), "acme", limit); err != nil {
+			t.Fatalf("Query(limit %d): %v", limit, err)
+		}
+	}
+
+	if len(bodies) != 2 {
+		t.Fatalf("got %d requests, want 2", len(bodies))
+	}
+	if b := bodies[0]; len(b) != 2 || b["q"] != "acme" || b["count"] != float64(4) {
+		t.Errorf("body with limit 4 = %v, want map[count:4 q:acme]", b)
+	}
+	if b := bodies[1]; len(b) != 1 || b["q"] != "acme" {
+		t.Errorf("body with limit 0 = %v, want map[q:acme]", b)
+	}
+	for _, b := range bodies {
+		if _, ok := b["query"]; ok {
+			t.Errorf("body %v still uses the default query key", b)
+		}
+	}
+}
+
+func TestCollapseWhitespace(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"tabs", "Acme\tbeat\t\testimates", "Acme beat estimates"},
+		{"crlf", "Acme beat\r\nestimates\r\n", "Acme beat estimates"},
+		{"no-break space", "Acme\u00a0beat \u00a0 estimates", "Acme beat estimates"},
+		{"em space", "\u2003Acme\u2003\u2003beat estimates", "Acme beat estimates"},
+		{"mixed", " \tAcme\r\n\u00a0beat\u2003\nestimates ", "Acme beat estimates"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		if got := collapseWhitespace(tt.in); got != tt.want {
+			t.Errorf("%s: collapseWhitespace(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPrintItemsRawFieldsKeepsWhitespace(t *testing.T) {
+	item := newsItem{Title: "Acme beats estimates", Source: "Reuters", Summary: "Acme\tbeat\r\nestimates\u00a0today"}
+	var buf bytes.Buffer
+	printItems(&buf, []newsItem{item}, displayOptions{collapseWhitespace: true, rawFields: true, location: time.UTC})
+	if want := "Summary: " + item.Summary + "\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("text output under -raw-fields missing %q:\n%s", want, buf.String())
+	}
+}
+
+var indexedItems = []newsItem{
+	{Title: "Acme beats estimates", Source: "Reuters", URL: "https://example.com/a"},
+	{Title: "Regulators probe Acme", Source: "FT", URL: "https://example.com/b"},
+}
+
+func TestPrintItemsIndexesTitles(t *testing.T) {
+	var buf bytes.Buffer
+	printItems(&buf, indexedItems, displayOptions{indexTitles: true, location: time.UTC})
+	for _, want := range []string{"[1] Acme beats estimates\n", "[2] Regulators probe Acme\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("text output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestWriteTSVIndexesTitles(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeTSV(&buf, indexedItems, displayOptions{indexTitles: true}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want header and 2 rows:\n%s", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "index\ttitle\t") {
+		t.Errorf("header = %q, want it to start with index and title", lines[0])
+	}
+	for i, want := range []string{"1\tAcme beats estimates\t", "2\tRegulators probe Acme\t"} {
+		if !strings.HasPrefix(lines[i+1], want) {
+			t.Errorf("row %d = %q, want prefix %q", i+1, lines[i+1], want)
+		}
+	}
+}
+
+// chunkedServer streams body in small flushed pieces, so it is sent with
+// chunked encoding and no Content-Length.
+func chunkedServer(body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		for len(body) > 0 {
+			n := min(16, len(body))
+			w.Write([]byte(body[:n]))
+			flusher.Flush()
+			body = body[n:]
+		}
+	}))
+}
+
+func TestMaxResponseSizeChunked(t *testing.T) {
+	body := `[{"title":"Acme beats estimates","source":"Reuters"},{"title":"Regulators probe Acme","source":"FT"}]`
+	tests := []struct {
+		name    string
+		max     int64
+		wantErr bool
+	}{
+		{"under limit", int64(len(body)) + 1, false},
+		{"at limit", int64(len(body)), false},
+		{"over limit", int64(len(body)) - 1, true},
+		{"far over limit", 10, true},
+	}
+	for _, tt := range tests {
+		srv := chunkedServer(body)
+		c := newAgentClient(srv.URL, time.Second)
+		c.maxResponseSize = tt.max
+		var encoding []string
+		c.httpClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			if err == nil {
+				encoding = resp.TransferEncoding
+				if resp.ContentLength != -1 {
+					t.Errorf("%s: response has Content-Length %d, want none", tt.name, resp.ContentLength)
+				}
+			}
+			return resp, err
+		})
+		items, err := c.Query(context.Background(), "acme", 2)
+		srv.Close()
+		if len(encoding) == 0 || encoding[0] != "chunked" {
+			t.Errorf("%s: transfer encoding %v, want chunked", tt.name, encoding)
+		}
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "exceeds") {
+				t.Errorf("%s: err = %v, want a size error", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(items) != 2 || items[1].Title != "Regulators probe Acme" {
+			t.Errorf("%s: items = %+v", tt.name, items)
+		}
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestRetriesOnlyTruncatedJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantCalls int
+	}{
+		{"cut off mid-document", `[{"title":"Acme`, 3},
+		{"empty", ``, 3},
+		{"syntax error in last byte", `[1,]`, 1},
+		{"wrong shape", `{"x":1}`, 1},
+	}
+	for _, tt := range tests {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Write([]byte(tt.body))
+		}))
+		c := newAgentClient(srv.URL, time.Second)
+		c.retries, c.retryDelay = 2, time.Millisecond
+		_, err := c.Query(context.Background(), "acme", 1)
+		srv.Close()
+		if err == nil {
+			t.Errorf("%s: Query succeeded, want an error", tt.name)
+		}
+		if calls != tt.wantCalls {
+			t.Errorf("%s: %d requests, want %d (err %v)", tt.name, calls, tt.wantCalls, err)
+		}
+	}
+}
+
+func TestParseFieldMapRejectsDuplicateTargets(t *testing.T) {
+	for _, spec := range []string{"title=index", "title=source", "title=a,summary=a", "title=a,title=b"} {
+		if _, err := parseFieldMap(spec); err == nil {
+			t.Errorf("parseFieldMap(%q) succeeded, want an error", spec)
+		}
+	}
+	if _, err := parseFieldMap("title=headline,sentiment=mood"); err != nil {
+		t.Errorf("parseFieldMap: %v", err)
+	}
+}
+
+func TestCapabilitiesRetriesTransientFailures(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			// Drop the connection, as a network blip would.
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte(`{"version":"1.2.0","features":["analyze"]}`))
+	}))
+	defer srv.Close()
+
+	c := newAgentClient(srv.URL, time.Second)
+	if _, err := c.Capabilities(context.Background()); err == nil {
+		t.Fatal("first probe succeeded, want the dropped connection reported")
+	}
+	for i := 0; i < 2; i++ {
+		caps, err := c.Capabilities(context.Background())
+		if err != nil || !caps.supports("analyze") {
+			t.Errorf("probe %d = %v, %v; want the reported capabilities", i+2, caps, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("%d probes sent, want 2", calls)
+	}
+}
+
+func TestCapabilitiesCachesMissingEndpoint(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	c := newAgentClient(srv.URL, time.Second)
+	for i := 0; i < 2; i++ {
+		caps, err := c.Capabilities(context.Background())
+		if !errors.Is(err, errNoCapabilities) || caps.Version != baselineCapabilities.Version {
+			t.Errorf("probe %d = %v, %v; want the baseline and errNoCapabilities", i+1, caps, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("%d probes sent, want 1", calls)
+	}
+}
+
+func TestAnalyzeTextWithoutCapabilities(t *testing.T) {
+	tests := []struct {
+		name      string
+		caps      string // "" for no /capabilities endpoint
+		analyze   bool   // whether /analyze-text exists
+		wantPosts int
+		wantErr   string
+	}{
+		{"unknown, endpoint missing", "", false, 1, "no /analyze-text endpoint"},
+		{"unknown, endpoint present", "", true, 1, ""},
+		{"reported without analyze", `{"version":"1.0","features":[]}`, true, 0, "does not support text analysis"},
+	}
+	for _, tt := range tests {
+		posts := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/capabilities" && tt.caps != "":
+				w.Write([]byte(tt.caps))
+			case r.URL.Path == "/analyze-text":
+				posts++
+				if !tt.analyze {
+					http.NotFound(w, r)
+					return
+				}
+				w.Write([]byte(`{"title":"Snippet","sentiment":"positive","sentiment_score":0.5}`))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		c := newAgentClient(srv.URL, time.Second)
+		item, err := c.AnalyzeText(context.Background(), "Acme beat estimates")
+		srv.Close()
+		if posts != tt.wantPosts {
+			t.Errorf("%s: %d posts to /analyze-text, want %d", tt.name, posts, tt.wantPosts)
+		}
+		if tt.wantErr == "" {
+			if err != nil || item.Sentiment != "positive" {
+				t.Errorf("%s: AnalyzeText = %+v, %v", tt.name, item, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSplitTopics(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"acme", []string{"acme"}},
+		{"acme; regulators ;", []string{"acme", "regulators"}},
+		{"acme;", []string{"acme"}},
+		{" ; ;", nil},
+	}
+	for _, tt := range tests {
+		got := splitTopics(tt.line)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("splitTopics(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
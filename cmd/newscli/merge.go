@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// queryBackends sends query to every backend concurrently. It returns the
+// merged results, tagged with the backend that supplied them and with
+// duplicates dropped, along with each backend's error (nil on success) in
+// backend order.
+func queryBackends(ctx context.Context, backends []*agentClient, query string, limit int) ([]newsItem, []error) {
+	results := make([][]newsItem, len(backends))
+	errs := make([]error, len(backends))
+	var wg sync.WaitGroup
+	for i, backend := range backends {
+		wg.Add(1)
+		go func(i int, backend *agentClient) {
+			defer wg.Done()
+			results[i], errs[i] = backend.Query(ctx, query, limit)
+		}(i, backend)
+	}
+	wg.Wait()
+
+	var merged []newsItem
+	seen := make(map[string]int)
+	for i, items := range results {
+		label := backendLabel(backends[i])
+		for _, item := range items {
+			item.backend = label
+			key := mergeKey(item)
+			if idx, dup := seen[key]; dup {
+				merged[idx].absorbed = append(merged[idx].absorbed, item)
+				continue
+			}
+			seen[key] = len(merged)
+			merged = append(merged, item)
+		}
+	}
+	return merged, errs
+}
+
+// mergeKey identifies the same article across backends: by URL when there is
+// one, otherwise by normalized title.
+func mergeKey(item newsItem) string {
+	if u := strings.TrimSpace(item.URL); u != "" {
+		return "url:" + strings.TrimRight(u, "/")
+	}
+	return "title:" + normalizeTitle(item.Title)
+}
+
+// backendLabel is the short name shown for a backend: its host.
+func backendLabel(c *agentClient) string {
+	if parsed, err := url.Parse(c.baseURL); err == nil && parsed.Host != "" {
+		return parsed.Host
+	}
+	return c.baseURL
+}
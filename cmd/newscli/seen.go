@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Keys accepted by -scrub-key for recognising an article seen earlier.
+const (
+	scrubKeyURL   = "url"
+	scrubKeyTitle = "title"
+)
+
+// seenSet remembers the articles already shown during a run so that later
+// queries can suppress them. With a non-zero window an article is forgotten
+// once that long has passed since it was first shown, so long sessions can
+// resurface genuinely new coverage and memory stays bounded.
+type seenSet struct {
+	key    string
+	window time.Duration
+	keys   map[string]time.Time // when each article was first shown
+}
+
+func newSeenSet(key string, window time.Duration) (*seenSet, error) {
+	if key != scrubKeyURL && key != scrubKeyTitle {
+		return nil, fmt.Errorf("unknown key %q (want %s or %s)", key, scrubKeyURL, scrubKeyTitle)
+	}
+	if window < 0 {
+		return nil, fmt.Errorf("window %s is negative", window)
+	}
+	return &seenSet{key: key, window: window, keys: make(map[string]time.Time)}, nil
+}
+
+// itemKey returns the identity of item under the set's key; items without
+// one (no URL, or a title with no letters or digits) are never suppressed.
+func (s *seenSet) itemKey(item newsItem) string {
+	if s.key == scrubKeyTitle {
+		return normalizeTitle(item.Title)
+	}
+	return strings.TrimRight(strings.TrimSpace(item.URL), "/")
+}
+
+// evict forgets the articles first shown more than the window before now.
+func (s *seenSet) evict(now time.Time) {
+	if s.window == 0 {
+		return
+	}
+	for key, at := range s.keys {
+		if now.Sub(at) > s.window {
+			delete(s.keys, key)
+		}
+	}
+}
+
+// filter drops items recorded as shown before and reports how many were
+// dropped. Repeats within items are left to the other duplicate filters.
+func (s *seenSet) filter(items []newsItem, now time.Time) ([]newsItem, int) {
+	s.evict(now)
+	var kept []newsItem
+	suppressed := 0
+	for _, item := range items {
+		if _, ok := s.keys[s.itemKey(item)]; ok {
+			suppressed++
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept, suppressed
+}
+
+// record marks items as shown at now, keeping the time an article was first
+// shown.
+func (s *seenSet) record(items []newsItem, now time.Time) {
+	for _, item := range items {
+		key := s.itemKey(item)
+		if _, ok := s.keys[key]; key != "" && !ok {
+			s.keys[key] = now
+		}
+	}
+}
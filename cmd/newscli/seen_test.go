@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeenSetSuppressesOnlyRecordedArticles(t *testing.T) {
+	seen, err := newSeenSet(scrubKeyURL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	a := newsItem{Title: "Acme beats estimates", URL: "https://example.com/a"}
+	b := newsItem{Title: "Regulators probe Acme", URL: "https://example.com/b"}
+	c := newsItem{Title: "Acme hires", URL: "https://example.com/c"}
+
+	// A repeat within one result set is not an article shown earlier.
+	if kept, suppressed := seen.filter([]newsItem{a, a, c}, now); len(kept) != 3 || suppressed != 0 {
+		t.Errorf("first query: kept %d, suppressed %d, want 3 and 0", len(kept), suppressed)
+	}
+	// c was dropped by a display filter, so only a counts as shown.
+	seen.record([]newsItem{a}, now)
+
+	kept, suppressed := seen.filter([]newsItem{a, b, c}, now)
+	if suppressed != 1 || len(kept) != 2 || kept[0].URL != b.URL || kept[1].URL != c.URL {
+		t.Errorf("second query: kept %+v, suppressed %d, want b and c with 1 suppressed", kept, suppressed)
+	}
+}
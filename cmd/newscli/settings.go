@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// settings are the per-session options that can be changed at runtime with
+// the interactive `set` command.
+type settings struct {
+	limit         int
+	timeout       time.Duration
+	minSources    int
+	sort          string
+	recencyWeight float64
+	display       displayOptions
+}
+
+// settingsHistoryLimit bounds how many `set` changes `undo` can revert.
+const settingsHistoryLimit = 20
+
+// settingsHistory is a bounded stack of settings snapshots; the oldest
+// snapshot is dropped once the limit is reached.
+type settingsHistory struct {
+	snapshots []settings
+}
+
+func (h *settingsHistory) push(s settings) {
+	if len(h.snapshots) == settingsHistoryLimit {
+		h.snapshots = append(h.snapshots[:0], h.snapshots[1:]...)
+	}
+	h.snapshots = append(h.snapshots, s)
+}
+
+func (h *settingsHistory) pop() (settings, bool) {
+	if len(h.snapshots) == 0 {
+		return settings{}, false
+	}
+	last := h.snapshots[len(h.snapshots)-1]
+	h.snapshots = h.snapshots[:len(h.snapshots)-1]
+	return last, true
+}
+
+// setting describes one option exposed through `set`.
+type setting struct {
+	name  string
+	usage string
+	get   func(*settings) string
+	set   func(*settings, string) error
+}
+
+var settingList = []setting{
+	{
+		name:  "limit",
+		usage: "maximum articles to request per query",
+		get:   func(s *settings) string { return strconv.Itoa(s.limit) },
+		set: func(s *settings, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return errors.New("must be a non-negative integer")
+			}
+			s.limit = n
+			return nil
+		},
+	},
+	{
+		name:  "format",
+		usage: "output format (" + strings.Join(outputFormats, ", ") + ")",
+		get:   func(s *settings) string { return s.display.format },
+		set: func(s *settings, v string) error {
+			if !validFormat(v) {
+				return fmt.Errorf("must be one of %s", strings.Join(outputFormats, ", "))
+			}
+			s.display.format = v
+			return nil
+		},
+	},
+	{
+		name:  "min-sources",
+		usage: "minimum distinct sources per story",
+		get:   func(s *settings) string { return strconv.Itoa(s.minSources) },
+		set: func(s *settings, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return errors.New("must be a non-negative integer")
+			}
+			s.minSources = n
+			return nil
+		},
+	},
+	{
+		name:  "sort",
+		usage: "result order (" + strings.Join(sortOrders, ", ") + ")",
+		get:   func(s *settings) string { return s.sort },
+		set: func(s *settings, v string) error {
+			if !validSort(v) {
+				return fmt.Errorf("must be one of %s", strings.Join(sortOrders, ", "))
+			}
+			s.sort = v
+			return nil
+		},
+	},
+	{
+		name:  "recency-weight",
+		usage: "share of recency in the smart ranking",
+		get:   func(s *settings) string { return strconv.FormatFloat(s.recencyWeight, 'f', -1, 64) },
+		set: func(s *settings, v string) error {
+			w, err := strconv.ParseFloat(v, 64)
+			if err != nil || validRecencyWeight(w) != nil {
+				return errors.New("must be a number from 0 to 1")
+			}
+			s.recencyWeight = w
+			return nil
+		},
+	},
+	{
+		name:  "collapse-whitespace",
+		usage: "collapse whitespace in summaries and excerpts",
+		get:   func(s *settings) string { return strconv.FormatBool(s.display.collapseWhitespace) },
+		set:   boolSetter(func(s *settings) *bool { return &s.display.collapseWhitespace }),
+	},
+	{
+		name:  "explain-score",
+		usage: "describe sentiment scores in words",
+		get:   func(s *settings) string { return strconv.FormatBool(s.display.explainScore) },
+		set:   boolSetter(func(s *settings) *bool { return &s.display.explainScore }),
+	},
+	{
+		name:  "reading-time",
+		usage: "show estimated reading times",
+		get:   func(s *settings) string { return strconv.FormatBool(s.display.readingTime) },
+		set:   boolSetter(func(s *settings) *bool { return &s.display.readingTime }),
+	},
+}
+
+func boolSetter(field func(*settings) *bool) func(*settings, string) error {
+	return func(s *settings, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		*field(s) = b
+		return nil
+	}
+}
+
+// apply handles the arguments of a `set` command. With no arguments it lists
+// every option and its current value; otherwise it expects "<name> <value>".
+func (s *settings) apply(w io.Writer, args string) error {
+	if args == "" {
+		for _, opt := range settingList {
+			fmt.Fprintf(w, "  %-20s %-10s %s\n", opt.name, opt.get(s), opt.usage)
+		}
+		return nil
+	}
+	name, value, _ := strings.Cut(args, " ")
+	value = strings.TrimSpace(value)
+	for _, opt := range settingList {
+		if !strings.EqualFold(opt.name, name) {
+			continue
+		}
+		if value == "" {
+			return fmt.Errorf("usage: set %s <value>", opt.name)
+		}
+		if err := opt.set(s, value); err != nil {
+			return fmt.Errorf("%s %w", opt.name, err)
+		}
+		fmt.Fprintf(w, "%s = %s\n", opt.name, opt.get(s))
+		return nil
+	}
+	return fmt.Errorf("unknown option %q; type 'set' to list options", name)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Orderings accepted by -sort.
+const (
+	sortBackend = "backend"
+	sortSmart   = "smart"
+)
+
+var sortOrders = []string{sortBackend, sortSmart}
+
+func validSort(name string) bool {
+	for _, o := range sortOrders {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+// recencyHalfLife is the article age at which the recency signal used by
+// -sort smart has dropped to one half.
+const recencyHalfLife = 24 * time.Hour
+
+// smartSort orders items by a blend of relevance and recency. Relevance is
+// the agent's own ranking, scaled from 1 for the first item to 0 for the
+// last; recency decays from 1 with recencyHalfLife. recencyWeight (0 to 1)
+// sets the share of recency in the blend. Items without a parseable
+// publication date are ranked on relevance alone, and ties keep the agent's
+// order.
+func smartSort(items []newsItem, recencyWeight float64, now time.Time) []newsItem {
+	n := len(items)
+	if n < 2 {
+		return items
+	}
+	ranks := make([]float64, n)
+	for i, item := range items {
+		relevance := 1 - float64(i)/float64(n-1)
+		published, ok := parsePublished(item.PublishedAt, now.Location())
+		if !ok {
+			ranks[i] = relevance
+			continue
+		}
+		age := now.Sub(published)
+		if age < 0 {
+			age = 0
+		}
+		recency := math.Pow(0.5, float64(age)/float64(recencyHalfLife))
+		ranks[i] = (1-recencyWeight)*relevance + recencyWeight*recency
+	}
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return ranks[order[a]] > ranks[order[b]] })
+	sorted := make([]newsItem, n)
+	for i, idx := range order {
+		sorted[i] = items[idx]
+	}
+	return sorted
+}
+
+// publishedLayouts are the published_at formats parsePublished accepts, in
+// the order they are tried: RFC 3339 as the agent sends it, then the feed and
+// plain date formats some providers pass through.
+var publishedLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	time.RFC850,
+	time.RFC822Z,
+	time.RFC822,
+	time.ANSIC,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parsePublished parses a publication timestamp in any of publishedLayouts.
+// Values without a zone are read in loc.
+func parsePublished(value string, loc *time.Location) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range publishedLayouts {
+		if parsed, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func validRecencyWeight(weight float64) error {
+	if weight < 0 || weight > 1 {
+		return fmt.Errorf("recency weight %v is outside 0..1", weight)
+	}
+	return nil
+}
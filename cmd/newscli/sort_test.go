@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePublished(t *testing.T) {
+	berlin := time.FixedZone("CET", 3600)
+	want := time.Date(2026, 10, 12, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"2026-10-12T09:30:00Z", want},
+		{"2026-10-12T11:30:00+02:00", want},
+		{"Mon, 12 Oct 2026 09:30:00 +0000", want},
+		{"Mon, 12 Oct 2026 09:30:00 GMT", want},
+		{"Mon, 12 Oct 2026 10:30:00 +0100", want},
+		{"Monday, 12-Oct-26 09:30:00 UTC", want},
+		{" 2026-10-12 10:30:00 ", want},
+		{"2026-10-12T10:30:00", want},
+		{"2026-10-12", time.Date(2026, 10, 12, 0, 0, 0, 0, berlin)},
+	}
+	for _, tt := range tests {
+		got, ok := parsePublished(tt.value, berlin)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("parsePublished(%q) = %v, %v; want %v", tt.value, got, ok, tt.want)
+		}
+	}
+	for _, value := range []string{"", "yesterday", "12/10/2026"} {
+		if _, ok := parsePublished(value, berlin); ok {
+			t.Errorf("parsePublished(%q) succeeded, want failure", value)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runStats accumulates the metrics written by -stats-file. A nil *runStats
+// records nothing, so callers need not check whether stats are enabled.
+type runStats struct {
+	mu sync.Mutex
+
+	queries  int
+	errors   int
+	received int
+	shown    int
+	latency  time.Duration
+	byLabel  map[string]int
+	started  time.Time
+}
+
+func newRunStats() *runStats {
+	return &runStats{byLabel: make(map[string]int), started: time.Now()}
+}
+
+// recordQuery notes one request to the agent and how many articles it
+// returned.
+func (s *runStats) recordQuery(latency time.Duration, received int, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries++
+	s.latency += latency
+	if err != nil {
+		s.errors++
+		return
+	}
+	s.received += received
+}
+
+// recordShown notes the articles displayed after filtering.
+func (s *runStats) recordShown(items []newsItem) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shown += len(items)
+	for _, item := range items {
+		s.byLabel[sentimentLabel(item)]++
+	}
+}
+
+// sentimentLabel returns the lower-cased sentiment of item, or "unknown".
+func sentimentLabel(item newsItem) string {
+	label := strings.ToLower(strings.TrimSpace(item.Sentiment))
+	if label == "" {
+		return "unknown"
+	}
+	return label
+}
+
+// statsReport is the JSON document written to -stats-file.
+type statsReport struct {
+	StartedAt        time.Time      `json:"started_at"`
+	FinishedAt       time.Time      `json:"finished_at"`
+	Queries          int            `json:"queries"`
+	Errors           int            `json:"errors"`
+	ArticlesReceived int            `json:"articles_received"`
+	ArticlesShown    int            `json:"articles_shown"`
+	ArticlesFiltered int            `json:"articles_filtered"`
+	Sentiment        map[string]int `json:"sentiment"`
+	TotalLatencyMS   int64          `json:"total_latency_ms"`
+	AvgLatencyMS     int64          `json:"avg_latency_ms"`
+}
+
+func (s *runStats) report() statsReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := statsReport{
+		StartedAt:        s.started,
+		FinishedAt:       time.Now(),
+		Queries:          s.queries,
+		Errors:           s.errors,
+		ArticlesReceived: s.received,
+		ArticlesShown:    s.shown,
+		ArticlesFiltered: s.received - s.shown,
+		Sentiment:        make(map[string]int, len(s.byLabel)),
+		TotalLatencyMS:   s.latency.Milliseconds(),
+	}
+	for label, n := range s.byLabel {
+		r.Sentiment[label] = n
+	}
+	if s.queries > 0 {
+		r.AvgLatencyMS = (s.latency / time.Duration(s.queries)).Milliseconds()
+	}
+	return r
+}
+
+// writeFile writes the report to path as indented JSON.
+func (s *runStats) writeFile(path string) error {
+	data, err := json.MarshalIndent(s.report(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestTimer records the phases of one HTTP request for -trace. The
+// transport may dial several addresses at once, so the trace callbacks take
+// mu and only the first dial to start, and the first to succeed or fail,
+// are kept.
+type requestTimer struct {
+	mu                     sync.Mutex
+	start                  time.Time
+	dnsStart, dnsDone      time.Time
+	connectStart, connDone time.Time
+	connFailed             time.Time
+	tlsStart, tlsDone      time.Time
+	wrote, firstByte, done time.Time
+	reused                 bool
+}
+
+// mark sets *at to now unless an earlier event already set it.
+func (t *requestTimer) mark(at *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if at.IsZero() {
+		*at = time.Now()
+	}
+}
+
+// trace attaches the timer to req, keeping any trace already on its context.
+func (t *requestTimer) trace(req *http.Request) *http.Request {
+	t.start = time.Now()
+	ct := &httptrace.ClientTrace{
+		DNSStart:     func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:      func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone) },
+		ConnectStart: func(string, string) { t.mark(&t.connectStart) },
+		ConnectDone: func(_, _ string, err error) {
+			if err != nil {
+				t.mark(&t.connFailed)
+				return
+			}
+			t.mark(&t.connDone)
+		},
+		TLSHandshakeStart: func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.mark(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.mark(&t.wrote) },
+		GotFirstResponseByte: func() { t.mark(&t.firstByte) },
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), ct))
+}
+
+// log marks the end of the request and writes the breakdown for query to
+// stderr. It is called on failure too, so a request stuck in DNS, connect,
+// TLS or waiting for the first byte still shows how far it got.
+func (t *requestTimer) log(host, query string, err error) {
+	t.mark(&t.done)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "trace %s %q: %s (failed)\n", host, query, t)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "trace %s %q: %s\n", host, query, t)
+}
+
+// String lists each phase that happened; TTFB runs from the request being
+// written to the first response byte, so it is mostly server time.
+func (t *requestTimer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var parts []string
+	phase := func(name string, from, to time.Time) {
+		if !from.IsZero() && !to.IsZero() {
+			parts = append(parts, fmt.Sprintf("%s %s", name, to.Sub(from).Round(time.Microsecond)))
+		}
+	}
+	if t.reused {
+		parts = append(parts, "reused connection")
+	}
+	phase("dns", t.dnsStart, t.dnsDone)
+	if t.connDone.IsZero() {
+		phase("connect failed after", t.connectStart, t.connFailed)
+	}
+	phase("connect", t.connectStart, t.connDone)
+	phase("tls", t.tlsStart, t.tlsDone)
+	phase("ttfb", t.wrote, t.firstByte)
+	phase("body", t.firstByte, t.done)
+	phase("total", t.start, t.done)
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRequestTimerConcurrentDials(t *testing.T) {
+	var timer requestTimer
+	req, _ := http.NewRequest(http.MethodGet, "http://agent.invalid/news", nil)
+	ct := httptrace.ContextClientTrace(timer.trace(req).Context())
+
+	// Dual-stack dialing reports both attempts from their own goroutines.
+	var wg sync.WaitGroup
+	for _, addr := range []string{"[::1]:80", "127.0.0.1:80"} {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			ct.ConnectStart("tcp", addr)
+			var err error
+			if strings.HasPrefix(addr, "[") {
+				err = errors.New("connection refused")
+			}
+			ct.ConnectDone("tcp", addr, err)
+		}(addr)
+	}
+	wg.Wait()
+	timer.mark(&timer.done)
+
+	got := timer.String()
+	if !strings.Contains(got, "connect ") || strings.Contains(got, "failed") {
+		t.Errorf("String() = %q, want the successful connect only", got)
+	}
+}
+
+func TestRequestTimerFailedConnect(t *testing.T) {
+	var timer requestTimer
+	req, _ := http.NewRequest(http.MethodGet, "http://agent.invalid/news", nil)
+	ct := httptrace.ContextClientTrace(timer.trace(req).Context())
+	ct.ConnectStart("tcp", "127.0.0.1:80")
+	ct.ConnectDone("tcp", "127.0.0.1:80", errors.New("connection refused"))
+	timer.mark(&timer.done)
+
+	if got := timer.String(); !strings.Contains(got, "connect failed after ") || !strings.Contains(got, "total ") {
+		t.Errorf("String() = %q, want the failed connect and the total", got)
+	}
+}
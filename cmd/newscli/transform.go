@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runTransform pipes items as a JSON array through command (split on
+// whitespace, without a shell) and decodes the array it prints on stdout.
+// Backend and clustering annotations are carried over to returned items that
+// match an original by URL or title.
+func runTransform(ctx context.Context, command string, items []newsItem) ([]newsItem, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	if items == nil {
+		items = []newsItem{}
+	}
+	input, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", args[0], err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", args[0], err)
+	}
+	output := bytes.TrimSpace(stdout.Bytes())
+	if !bytes.HasPrefix(output, []byte("[")) {
+		return nil, fmt.Errorf("%s: output is not a JSON array", args[0])
+	}
+	var transformed []newsItem
+	if err := json.Unmarshal(output, &transformed); err != nil {
+		return nil, fmt.Errorf("%s: invalid output: %w", args[0], err)
+	}
+	originals := make(map[string]newsItem, len(items))
+	for _, item := range items {
+		originals[mergeKey(item)] = item
+	}
+	for i, item := range transformed {
+		if orig, ok := originals[mergeKey(item)]; ok {
+			transformed[i].coverage, transformed[i].backend, transformed[i].absorbed = orig.coverage, orig.backend, orig.absorbed
+		}
+	}
+	return transformed, nil
+}
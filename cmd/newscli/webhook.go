@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// headerList collects repeated -webhook-header flags.
+type headerList []string
+
+func (h *headerList) String() string { return strings.Join(*h, ", ") }
+
+func (h *headerList) Set(value string) error {
+	name, _, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return errors.New(`want "Name: value"`)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// webhook posts query results to a URL when its conditions are met.
+type webhook struct {
+	url        string
+	headers    http.Header
+	ifNegative bool
+	ifNonEmpty bool
+	// verbose shows the full URL in errors. Chat webhook URLs embed their
+	// secret, so otherwise only the host is named.
+	verbose bool
+	client  *http.Client
+}
+
+func newWebhook(url string, headers headerList, timeout time.Duration) *webhook {
+	h := make(http.Header)
+	for _, header := range headers {
+		name, value, _ := strings.Cut(header, ":")
+		h.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return &webhook{url: url, headers: h, client: &http.Client{Timeout: timeout}}
+}
+
+// webhookPayload is the JSON body posted to the webhook. Text is a one-line
+// summary so chat incoming webhooks (Slack, Teams) can display it as is.
+type webhookPayload struct {
+	Text     string     `json:"text"`
+	Query    string     `json:"query"`
+	Articles []newsItem `json:"articles"`
+}
+
+// shouldSend reports whether items satisfy every enabled condition.
+func (w *webhook) shouldSend(items []newsItem) bool {
+	if w.ifNonEmpty && len(items) == 0 {
+		return false
+	}
+	if w.ifNegative && countNegative(items) == 0 {
+		return false
+	}
+	return true
+}
+
+// send posts the results for query if the conditions are met.
+func (w *webhook) send(ctx context.Context, query string, items []newsItem) error {
+	if !w.shouldSend(items) {
+		return nil
+	}
+	if items == nil {
+		items = []newsItem{}
+	}
+	body, err := json.Marshal(webhookPayload{
+		Text:     fmt.Sprintf("%d articles for %q (%d negative)", len(items), query, countNegative(items)),
+		Query:    query,
+		Articles: items,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return w.error(err)
+	}
+	for name, values := range w.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return w.error(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return w.error(fmt.Errorf("webhook returned status %s", resp.Status))
+	}
+	return nil
+}
+
+// error names the webhook by host, or by full URL under -v, and drops the
+// URL that *url.Error would otherwise repeat.
+func (w *webhook) error(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	target := w.url
+	if !w.verbose {
+		target = "webhook"
+		if parsed, perr := url.Parse(w.url); perr == nil && parsed.Host != "" {
+			target = parsed.Host
+		}
+	}
+	return fmt.Errorf("%s: %w", target, err)
+}
+
+// countNegative counts items labelled negative or with a negative score.
+func countNegative(items []newsItem) int {
+	n := 0
+	for _, item := range items {
+		if strings.EqualFold(strings.TrimSpace(item.Sentiment), "negative") || item.SentimentScore < 0 {
+			n++
+		}
+	}
+	return n
+}
@@ -1,3 +1,14 @@
 module news-agent-cli
 
 go 1.21
+
+require (
+	github.com/itchyny/gojq v0.12.17
+	golang.org/x/term v0.27.0
+	golang.org/x/text v0.21.0
+)
+
+require (
+	github.com/itchyny/timefmt-go v0.1.6 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+)